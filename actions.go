@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// something that keys can be bound to in the files view
+type action struct {
+	name string
+	help string // may have %s for the arg
+	arg  string // description of the argument, empty if the action takes none
+	run  func(self *model, arg string) (tea.Model, tea.Cmd)
+}
+
+// in the order of the help view
+var actions = []action{
+	{name: "help", help: "Open this help", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.currentView = ViewHelp
+		return self, nil
+	}},
+	{name: "quit", help: "Quit application", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if n := self.runningJobs(); n > 0 {
+			self.openPrompt(yesNoPrompt(fmt.Sprintf("%d jobs are running, quit anyway?", n), tea.Quit))
+			return self, nil
+		}
+		return self, tea.Quit
+	}},
+	{name: "force-quit", help: "Quit even if jobs are running", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self, tea.Quit
+	}},
+	{name: "move-down", help: "Down", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.moveCursor(1)
+		self.syncBounds()
+		return self.refreshPreview()
+	}},
+	{name: "move-up", help: "Up", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.moveCursor(-1)
+		self.syncBounds()
+		return self.refreshPreview()
+	}},
+	{name: "half-page-down", help: "Half page down", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.moveCursor((self.bottomIndex() - self.topIndex) / 2)
+		self.syncBounds()
+		return self.refreshPreview()
+	}},
+	{name: "half-page-up", help: "Half page up", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.moveCursor(-(self.bottomIndex() - self.topIndex) / 2)
+		self.syncBounds()
+		return self.refreshPreview()
+	}},
+	{name: "move-top", help: "First file", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.moveCursor(-self.len())
+		self.syncBounds()
+		return self.refreshPreview()
+	}},
+	{name: "move-bottom", help: "Last file", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.moveCursor(self.len())
+		self.syncBounds()
+		return self.refreshPreview()
+	}},
+	{name: "updir", help: "Updir", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self, refreshFiles(filepath.Dir(self.cwd))
+	}},
+	{name: "open", help: "Downdir or open in $EDITOR", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self.open()
+	}},
+	{name: "open-external", help: "Open in app", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if self.empty {
+			return self, nil
+		}
+		current := self.current()
+		return self, openExternalCmd(self.config.opener, current.Name)
+	}},
+	{name: "follow-link", help: "Go to the target of symlink", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if self.empty {
+			return self, nil
+		}
+		current := self.current()
+		if !current.IsLink {
+			self.status = newStatus(fmt.Sprintf("%v is not a symlink", current.Name), true)
+			return self, clearStatusCmd(self.status.id)
+		}
+		target := current.targetPath()
+		return self, refreshFilesFocus(filepath.Dir(target), filepath.Base(target))
+	}},
+	{name: "cd", help: "Go to %s", arg: "directory", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self, refreshFiles(expandHome(arg))
+	}},
+	{name: "search", help: "Search", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.openSearch()
+		return self, nil
+	}},
+	{name: "search-next", help: "Next match", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self.searchNext(1)
+	}},
+	{name: "search-prev", help: "Previous match", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self.searchNext(-1)
+	}},
+	{name: "filter", help: "Filter files (C-t switch substring/glob/regex, empty clears)", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.openFilter()
+		return self, nil
+	}},
+	{name: "find", help: "Find files below this dir (C-j/C-k or up/down to choose)", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self, self.openFinder()
+	}},
+	{name: "sort", help: "Sort by name/time/size", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		sorts := map[string]SortType{"n": SortName, "t": SortModified, "s": SortSize}
+		choices := []choice{{"n", "name"}, {"t", "time"}, {"s", "size"}}
+		self.openPrompt(choicePrompt("sort by", choices, func(key string, ok bool) tea.Cmd {
+			if !ok {
+				return nil
+			}
+			return func() tea.Msg {
+				return sortMsg{sorts[strings.ToLower(key)]}
+			}
+		}))
+		return self, nil
+	}},
+	{name: "sort-name", help: "Sort by name", run: sortAction(SortName)},
+	{name: "sort-time", help: "Sort by time", run: sortAction(SortModified)},
+	{name: "sort-size", help: "Sort by size", run: sortAction(SortSize)},
+	{name: "select-down", help: "Select file and go down", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		// TODO: save selections to registers?
+		if self.empty {
+			return self, nil
+		}
+		self.selections.Toggle(self.current().Path)
+		self.moveCursor(1)
+		return self.refreshPreview()
+	}},
+	{name: "select-up", help: "Select file and go up", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if self.empty {
+			return self, nil
+		}
+		self.selections.Toggle(self.current().Path)
+		self.moveCursor(-1)
+		return self.refreshPreview()
+	}},
+	// TODO: yank paths to clipboard
+	// TODO: marks like in Vim (m + letter, ' + letter, pasting to mark, etc)
+	{name: "clear-selections", help: "Clear selections", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.selections.Clear()
+		return self, nil
+	}},
+	{name: "paste-copy", help: "Copy selections", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if len(self.selections) == 0 {
+			return self, nil
+		}
+		cmd := copyFilesCmd(self.selections, self.cwd, self.config.conflict)
+		return self, self.confirm("copy", fmt.Sprintf("copy %d files here?", len(self.selections)), cmd)
+	}},
+	{name: "paste-move", help: "Move selections", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if len(self.selections) == 0 {
+			return self, nil
+		}
+		cmd := moveFilesCmd(self.selections, self.cwd, self.config.conflict)
+		return self, self.confirm("move", fmt.Sprintf("move %d files here?", len(self.selections)), cmd)
+	}},
+	{name: "paste-symlink", help: "Paste selections as absolute symlinks", run: linkAction(LinkAbsolute)},
+	{name: "paste-relative-symlink", help: "Paste selections as relative symlinks", run: linkAction(LinkRelative)},
+	{name: "paste-hardlink", help: "Paste selections as hard links", run: linkAction(LinkHard)},
+	{name: "trash", help: "Trash selections", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if len(self.selections) == 0 {
+			return self, nil
+		}
+		cmd := trashFilesCmd(self.selections)
+		return self, self.confirm("trash", fmt.Sprintf("trash %d files?", len(self.selections)), cmd)
+	}},
+	{name: "delete", help: "Delete selections permanently", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if len(self.selections) == 0 {
+			return self, nil
+		}
+		cmd := deleteFilesCmd(self.selections)
+		return self, self.confirm("delete", fmt.Sprintf("delete %d files permanently?", len(self.selections)), cmd)
+	}},
+	{name: "create", help: "Create file", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		cwd := self.cwd
+		self.openPrompt(inputPrompt("create", "create: ", "", func(name string) tea.Cmd {
+			return createFileCmd(name, cwd)
+		}))
+		return self, nil
+	}},
+	{name: "mkdir", help: "Create directory", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		cwd := self.cwd
+		self.openPrompt(inputPrompt("create", "mkdir: ", "", func(name string) tea.Cmd {
+			return createFileCmd(name+"/", cwd)
+		}))
+		return self, nil
+	}},
+	{name: "rename", help: "Rename file", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if self.empty {
+			return self, nil
+		}
+		current := self.current()
+		cwd, confirmOverwrite := self.cwd, self.config.confirm.Contains("overwrite")
+		p := inputPrompt("rename", "rename: ", current.Name, func(name string) tea.Cmd {
+			return renameFileCmd(current.Path, filepath.Join(cwd, name), confirmOverwrite)
+		})
+		// before the extension, like most file dialogs do
+		if i := strings.LastIndex(current.Name, "."); i > 0 && !current.IsDir {
+			p.input.pos = len([]rune(current.Name[:i]))
+		}
+		self.openPrompt(p)
+		return self, nil
+	}},
+	{name: "bulk-rename", help: "Rename selections or all files in $EDITOR", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		paths := self.selections.Values()
+		if len(paths) == 0 {
+			for _, file := range self.visibleFiles() {
+				paths = append(paths, file.Path)
+			}
+		}
+		if len(paths) == 0 {
+			return self, nil
+		}
+		sort.Strings(paths)
+		return self, bulkRenameCmd(self.cwd, paths)
+	}},
+	{name: "undo", help: "Undo file operation", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self, self.undo()
+	}},
+	{name: "redo", help: "Redo file operation", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self, self.redo()
+	}},
+	{name: "trash-view", help: "Open trash (r restore, X delete, E empty)", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.currentView = ViewTrash
+		self.trashCursor = 0
+		return self, listTrashCmd()
+	}},
+	{name: "jobs-view", help: "Open jobs (x cancel, C clear finished)", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.currentView = ViewJobs
+		self.jobsCursor = 0
+		return self, nil
+	}},
+	{name: "selections-view", help: "Show selections", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.currentView = ViewSelections
+		return self, nil
+	}},
+	{name: "reload-config", help: "Source the config file again", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self, func() tea.Msg { return reloadConfigMsg{} }
+	}},
+	{name: "errors-view", help: "Show config errors", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.currentView = ViewErrors
+		return self, nil
+	}},
+	{name: "toggle-hidden", help: "Toggle hidden", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.toggleHidden()
+		return self.refreshPreview()
+	}},
+	{name: "toggle-dirsonly", help: "Toggle directories only", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.toggleDirsonly()
+		return self.refreshPreview()
+	}},
+	{name: "toggle-preview", help: "Toggle preview", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.togglePreview()
+		return self, nil
+	}},
+	{name: "reload", help: "Reload files", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		return self, refreshFiles(self.cwd)
+	}},
+	{name: "run", help: "Run command %s", arg: "command name", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		argv, ok := self.config.cmds[arg]
+		if !ok {
+			self.status = newStatus(fmt.Sprintf("unknown command %v", arg), true)
+			return self, clearStatusCmd(self.status.id)
+		}
+		env := []string{"fs=" + strings.Join(self.selections.Values(), "\n")}
+		if !self.empty {
+			env = append(env, "f="+self.current().Path)
+		}
+		return self, runCmd(argv, env)
+	}},
+	{name: "bookmark", help: "Bookmark this dir", arg: "bookmark name", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.bookmarks[arg] = self.cwd
+		return self, nil
+	}},
+	{name: "goto-bookmark", help: "Go to bookmark", arg: "bookmark name", run: func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if path, exists := self.bookmarks[arg]; exists {
+			return self, refreshFiles(path)
+		}
+		return self, nil
+	}},
+}
+
+func sortAction(sort SortType) func(self *model, arg string) (tea.Model, tea.Cmd) {
+	return func(self *model, arg string) (tea.Model, tea.Cmd) {
+		self.sortby(sort)
+		model, cmd := self.refreshPreview()
+		return model, tea.Batch(cmd, clearStatusCmd(self.status.id))
+	}
+}
+
+func linkAction(kind LinkKind) func(self *model, arg string) (tea.Model, tea.Cmd) {
+	return func(self *model, arg string) (tea.Model, tea.Cmd) {
+		if len(self.selections) == 0 {
+			return self, nil
+		}
+		return self, linkFilesCmd(self.selections, self.cwd, kind, self.config.conflict)
+	}
+}
+
+func actionByName(name string) (action, bool) {
+	for _, action := range actions {
+		if action.name == name {
+			return action, true
+		}
+	}
+	return action{}, false
+}
+
+func mustAction(name string) action {
+	action, ok := actionByName(name)
+	if !ok {
+		panic("unknown action " + name)
+	}
+	return action
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// vidir-like renaming: names are written to a temporary file, one per line,
+// and the lines that were changed in the editor become renames.
+
+// the temporary file is ready to be edited
+type bulkRenameEditMsg struct {
+	tmp   string
+	dir   string
+	paths []string
+	err   error
+}
+
+// the editor has exited
+type bulkRenameEditedMsg struct {
+	bulkRenameEditMsg
+}
+
+type bulkRenameMsg struct {
+	renamed int
+	total   int
+	entry   journalEntry
+	err     error
+}
+
+type renamePair struct {
+	from, to string
+	tmp      bool // to is a temporary name that breaks a cycle
+}
+
+// names as they are written to the file: relative to dir if possible
+func bulkRenameNames(dir string, paths []string) []string {
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = path
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			names[i] = rel
+		}
+	}
+	return names
+}
+
+func bulkRenameCmd(dir string, paths []string) tea.Cmd {
+	return func() tea.Msg {
+		msg := bulkRenameEditMsg{dir: dir, paths: paths}
+		for _, path := range paths {
+			if strings.Contains(path, "\n") {
+				msg.err = fmt.Errorf("%q: cannot rename files with newlines in names", path)
+				return msg
+			}
+		}
+		file, err := os.CreateTemp("", "bubblefm-rename-*.txt")
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		msg.tmp = file.Name()
+		_, err = file.WriteString(strings.Join(bulkRenameNames(dir, paths), "\n") + "\n")
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		msg.err = err
+		return msg
+	}
+}
+
+func editBulkRenameCmd(editor []string, msg bulkRenameEditMsg) tea.Cmd {
+	return execCmd(exec.Command(editor[0], append(editor[1:len(editor):len(editor)], msg.tmp)...), func(err error) tea.Msg {
+		msg.err = err
+		return bulkRenameEditedMsg{msg}
+	})
+}
+
+// compute renames from the edited file; asks before renaming if confirm
+func applyBulkRenameCmd(msg bulkRenameEditedMsg, confirm bool) tea.Cmd {
+	return func() tea.Msg {
+		defer os.Remove(msg.tmp)
+		if msg.err != nil {
+			return bulkRenameMsg{err: msg.err}
+		}
+		content, err := os.ReadFile(msg.tmp)
+		if err != nil {
+			return bulkRenameMsg{err: err}
+		}
+		lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		if len(content) == 0 {
+			lines = nil
+		}
+		pairs, err := planBulkRename(msg.dir, msg.paths, lines)
+		if err != nil {
+			return bulkRenameMsg{err: err}
+		}
+		if len(pairs) == 0 {
+			return bulkRenameMsg{}
+		}
+		total := len(filter(&pairs, func(pair renamePair) bool { return !pair.tmp }))
+		rename := func() tea.Msg {
+			renamed, done, err := runRenames(pairs)
+			return bulkRenameMsg{renamed, total, renameEntry(done), err}
+		}
+		if confirm {
+			return promptMsg{yesNoPrompt(fmt.Sprintf("rename %d files?", total), rename)}
+		}
+		return rename()
+	}
+}
+
+// renames in an order that can be executed one by one
+func planBulkRename(dir string, paths []string, lines []string) ([]renamePair, error) {
+	if len(lines) != len(paths) {
+		return nil, fmt.Errorf("expected %d lines, got %d; nothing renamed", len(paths), len(lines))
+	}
+
+	var pairs []renamePair
+	sources := make(set[string])
+	targets := make(set[string])
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			return nil, fmt.Errorf("empty name for %v; nothing renamed", paths[i])
+		}
+		to := line
+		if !filepath.IsAbs(to) {
+			to = filepath.Join(dir, to)
+		}
+		if to == paths[i] {
+			continue
+		}
+		if targets.Contains(to) {
+			return nil, fmt.Errorf("%v is a target more than once; nothing renamed", to)
+		}
+		targets.Add(to)
+		sources.Add(paths[i])
+		pairs = append(pairs, renamePair{from: paths[i], to: to})
+	}
+
+	// existing files may only be replaced if they are renamed away too
+	for _, pair := range pairs {
+		if _, err := os.Lstat(pair.to); err == nil && !sources.Contains(pair.to) {
+			return nil, fmt.Errorf("%v already exists; nothing renamed", pair.to)
+		}
+	}
+
+	// a rename can run when its target is not waiting to be renamed away.
+	// when none can, the rest are cycles (a->b, b->a) and one of them goes through a temporary name
+	var plan []renamePair
+	pending := make(set[string])
+	for _, pair := range pairs {
+		pending.Add(pair.from)
+	}
+	for len(pairs) > 0 {
+		var rest []renamePair
+		for _, pair := range pairs {
+			if pending.Contains(pair.to) {
+				rest = append(rest, pair)
+				continue
+			}
+			plan = append(plan, pair)
+			pending.Remove(pair.from)
+		}
+		if len(rest) == len(pairs) {
+			pair := rest[0]
+			tmp := filepath.Join(filepath.Dir(pair.from), fmt.Sprintf(".bubblefm-%d-%s", rand.Int(), filepath.Base(pair.from)))
+			plan = append(plan, renamePair{pair.from, tmp, true})
+			pending.Remove(pair.from)
+			pending.Add(tmp)
+			rest[0].from = tmp
+		}
+		pairs = rest
+	}
+	return plan, nil
+}
+
+// runs the renames until one fails, then renames the done ones back, because a later
+// rename could replace a file that was not moved away.
+// returns the number of renamed files and the renames that stay done
+func runRenames(pairs []renamePair) (renamed int, done []renamePair, err error) {
+	for _, pair := range pairs {
+		if err = renameMissing(pair.from, pair.to); err != nil {
+			break
+		}
+		done = append(done, pair)
+	}
+	if err != nil {
+		errs := []error{err}
+		var kept []renamePair
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := renameMissing(done[i].to, done[i].from); err != nil {
+				errs = append(errs, fmt.Errorf("%v: not renamed back: %w", done[i].to, err))
+				kept = append([]renamePair{done[i]}, kept...)
+			}
+		}
+		if len(kept) == 0 {
+			errs[0] = fmt.Errorf("%w; nothing renamed", err)
+		}
+		done, err = kept, errors.Join(errs...)
+	}
+	for _, pair := range done {
+		if !pair.tmp {
+			renamed++
+		}
+	}
+	return renamed, done, err
+}
+
+// the target is checked right before the rename, because os.Rename replaces it
+func renameMissing(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%v already exists", to)
+	}
+	return os.Rename(from, to)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBulkRename(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		from  []string
+		to    []string
+		want  map[string]string
+		err   string
+	}{
+		{
+			name:  "plain",
+			files: map[string]string{"a": "A", "b": "B"},
+			from:  []string{"a", "b"},
+			to:    []string{"c", "b"},
+			want:  map[string]string{"c": "A", "b": "B"},
+		},
+		{
+			name:  "swap",
+			files: map[string]string{"a": "A", "b": "B"},
+			from:  []string{"a", "b"},
+			to:    []string{"b", "a"},
+			want:  map[string]string{"a": "B", "b": "A"},
+		},
+		{
+			name:  "cycle of three",
+			files: map[string]string{"a": "A", "b": "B", "c": "C"},
+			from:  []string{"a", "b", "c"},
+			to:    []string{"b", "c", "a"},
+			want:  map[string]string{"a": "C", "b": "A", "c": "B"},
+		},
+		{
+			name:  "chain",
+			files: map[string]string{"a": "A", "b": "B"},
+			from:  []string{"a", "b"},
+			to:    []string{"b", "c"},
+			want:  map[string]string{"b": "A", "c": "B"},
+		},
+		{
+			name:  "into a new directory",
+			files: map[string]string{"a": "A"},
+			from:  []string{"a"},
+			to:    []string{"sub/dir/a"},
+			want:  map[string]string{"sub/dir/a": "A"},
+		},
+		{
+			name:  "existing target",
+			files: map[string]string{"a": "A", "b": "B", "c": "C"},
+			from:  []string{"a", "b"},
+			to:    []string{"c", "b"},
+			want:  map[string]string{"a": "A", "b": "B", "c": "C"},
+			err:   "already exists; nothing renamed",
+		},
+		{
+			name:  "same target twice",
+			files: map[string]string{"a": "A", "b": "B"},
+			from:  []string{"a", "b"},
+			to:    []string{"c", "c"},
+			want:  map[string]string{"a": "A", "b": "B"},
+			err:   "is a target more than once",
+		},
+		{
+			name:  "empty name",
+			files: map[string]string{"a": "A"},
+			from:  []string{"a"},
+			to:    []string{" "},
+			want:  map[string]string{"a": "A"},
+			err:   "empty name",
+		},
+		{
+			name:  "missing line",
+			files: map[string]string{"a": "A", "b": "B"},
+			from:  []string{"a", "b"},
+			to:    []string{"c"},
+			want:  map[string]string{"a": "A", "b": "B"},
+			err:   "expected 2 lines, got 1",
+		},
+		{
+			// b cannot go below the file sub, and a must not replace b then
+			name:  "failure is rolled back",
+			files: map[string]string{"a": "A", "b": "B", "sub": "S"},
+			from:  []string{"a", "b"},
+			to:    []string{"b", "sub/c"},
+			want:  map[string]string{"a": "A", "b": "B", "sub": "S"},
+			err:   "nothing renamed",
+		},
+		{
+			name:  "done renames are undone",
+			files: map[string]string{"a": "A", "b": "B", "sub": "S"},
+			from:  []string{"a", "b"},
+			to:    []string{"x", "sub/c"},
+			want:  map[string]string{"a": "A", "b": "B", "sub": "S"},
+			err:   "nothing renamed",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, test.files)
+			var paths []string
+			for _, name := range test.from {
+				paths = append(paths, filepath.Join(dir, name))
+			}
+			pairs, err := planBulkRename(dir, paths, test.to)
+			if err == nil {
+				_, _, err = runRenames(pairs)
+			}
+			if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+			got := readFiles(t, dir)
+			if len(got) != len(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			for name, content := range test.want {
+				if got[name] != content {
+					t.Errorf("got %v, want %v", got, test.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// a target that appears after planning is not replaced
+func TestRunRenamesTargetCreated(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a": "A"})
+	pairs, err := planBulkRename(dir, []string{filepath.Join(dir, "a")}, []string{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{"b": "B"})
+	renamed, done, err := runRenames(pairs)
+	if err == nil || renamed != 0 || len(done) != 0 {
+		t.Errorf("renamed %v, done %v, error %v", renamed, done, err)
+	}
+	if got := readFiles(t, dir); got["a"] != "A" || got["b"] != "B" {
+		t.Errorf("got %v", got)
+	}
+}
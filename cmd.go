@@ -3,9 +3,11 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -14,23 +16,59 @@ import (
 type filesRefreshMsg struct {
 	files []File
 	cwd   string
+	focus string // name of the file to put the cursor on
 	err   error
 }
 
 type copyFilesMsg struct {
-	err error
+	entry journalEntry
+	err   error
+}
+
+type trashFilesMsg struct {
+	trashed []string
+	items   []trashItem
+	total   int
+	err     error
 }
 
 type deleteFilesMsg struct {
-	err error
+	deleted []string
+	total   int
+	err     error
+}
+
+type trashListMsg struct {
+	items []trashItem
+	err   error
+}
+
+type trashChangedMsg struct {
+	text string
+	err  error
 }
 
 type moveFilesMsg struct {
-	err error
+	moved []string
+	total int
+	entry journalEntry
+	err   error
 }
 
 type createFileMsg struct {
-	err error
+	focus string
+	entry journalEntry
+	err   error
+}
+
+type renameFileMsg struct {
+	focus string
+	entry journalEntry
+	err   error
+}
+
+type sortMsg struct {
+	sort SortType
 }
 
 type clearStatusMsg struct {
@@ -47,85 +85,178 @@ func clearStatusCmd(id int) tea.Cmd {
 	})
 }
 
-// TODO: 1) messages for file operations progress
-// 2) quit only after all file operation tasks are done & force quit
+func copyFilesCmd(selections set[string], toPath string, policy ConflictPolicy) tea.Cmd {
+	paths := selections.Values()
+	op := newFileop("copying")
+	op.policy = policy
+	return op.start(func() (tea.Msg, error) {
+		err := op.copyAll(paths, toPath)
+		return copyFilesMsg{createEntry(op.created, op.replaced), err}, err
+	})
+}
+
+func moveFilesCmd(selections set[string], toPath string, policy ConflictPolicy) tea.Cmd {
+	paths := selections.Values()
+	op := newFileop("moving")
+	op.policy = policy
+	return op.start(func() (tea.Msg, error) {
+		moved, err := op.moveAll(paths, toPath)
+		entry := renameEntry(op.renamed)
+		entry.Replaced = op.replaced
+		return moveFilesMsg{moved, len(paths), entry, err}, err
+	})
+}
+
+func trashFilesCmd(selections set[string]) tea.Cmd {
+	paths := selections.Values()
+	op := newFileop("trashing")
+	return op.start(func() (tea.Msg, error) {
+		trashed, items, err := op.trashAll(paths)
+		return trashFilesMsg{trashed, items, len(paths), err}, err
+	})
+}
+
+func deleteFilesCmd(selections set[string]) tea.Cmd {
+	paths := selections.Values()
+	op := newFileop("deleting")
+	return op.start(func() (tea.Msg, error) {
+		deleted, err := op.deleteAll(paths)
+		return deleteFilesMsg{deleted, len(paths), err}, err
+	})
+}
 
-// TODO: cp files
-func copyFilesCmd(selections set[string], toPath string) tea.Cmd {
+func listTrashCmd() tea.Cmd {
 	return func() tea.Msg {
-		var msg copyFilesMsg
-		// for selection := range selections {
-		// 	src, err := os.Open(selection)
-		// 	if err != nil {
-		// 		msg.Err = err
-		// 		return msg
-		// 	}
-		// 	defer src.Close()
-		//
-		// dest, err := os.Create(filepath.Join(path, selection))
-		// 	if err != nil {
-		// 		msg.Err = err
-		// 		return msg
-		// 	}
-		// 	defer dest.Close()
-		//
-		// 	_, err = io.Copy(src, dest)
-		// 	if err != nil {
-		// 		msg.Err = err
-		// 		return msg
-		// 	}
-		// }
-		msg.err = errors.New("I don't feel like implementing it")
-		return msg
+		items, err := listTrash()
+		return trashListMsg{items, err}
 	}
 }
 
-// TODO: mv files
-func moveFilesCmd(selections set[string], toPath string) tea.Cmd {
+func restoreTrashCmd(item trashItem) tea.Cmd {
 	return func() tea.Msg {
-		var msg moveFilesMsg
-		msg.err = errors.New("I don't feel like implementing it")
-		return msg
+		err := item.restore()
+		return trashChangedMsg{fmt.Sprintf("restored %v", withTilde(item.Original)), err}
 	}
 }
 
-// TODO: rm files
-// trash?
-func deleteFilesCmd(selections set[string]) tea.Cmd {
+func removeTrashCmd(items []trashItem) tea.Cmd {
 	return func() tea.Msg {
-		var msg deleteFilesMsg
-		msg.err = errors.New("I don't feel like implementing it")
-		return msg
+		var errs []error
+		for _, item := range items {
+			if err := item.remove(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return trashChangedMsg{fmt.Sprintf("deleted %d items from trash", len(items)), errors.Join(errs...)}
 	}
 }
 
-// TODO: touch/mkdir
+// touch a file, or mkdir if name ends with a slash. intermediate directories are created
 func createFileCmd(name string, dir string) tea.Cmd {
 	return func() tea.Msg {
 		var msg createFileMsg
-		msg.err = errors.New("I don't feel like implementing it")
+		if strings.TrimSpace(name) == "" {
+			return msg
+		}
+		path := filepath.Join(dir, name)
+		// the entry of dir that contains the new file
+		msg.focus = strings.Split(filepath.Clean(name), string(filepath.Separator))[0]
+
+		if _, err := os.Lstat(path); err == nil {
+			msg.err = fmt.Errorf("%v already exists", name)
+			return msg
+		}
+		// the topmost directory that is created, for the journal
+		created := path
+		for parent := filepath.Dir(created); parent != dir && !exists(parent); parent = filepath.Dir(created) {
+			created = parent
+		}
+		msg.err = createFile(path, strings.HasSuffix(name, "/"))
+		if msg.err == nil {
+			msg.entry = createEntry([]string{created}, nil)
+		}
 		return msg
 	}
 }
 
-func refreshFiles(path string) tea.Cmd {
-	return func() tea.Msg {
-		var msg filesRefreshMsg
+func createFile(path string, isDir bool) error {
+	if isDir {
+		return os.MkdirAll(path, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
 
-		var err error
+// rename, asking before replacing an existing file if confirmOverwrite
+func renameFileCmd(from string, to string, confirmOverwrite bool) tea.Cmd {
+	return func() tea.Msg {
+		var msg renameFileMsg
+		if from == to {
+			return msg
+		}
+		if isInside(from, to) {
+			msg.err = fmt.Errorf("cannot rename %v to its parent %v", filepath.Base(from), to)
+			return msg
+		}
+		dir := filepath.Dir(from)
+		if rel, err := filepath.Rel(dir, to); err == nil {
+			msg.focus = strings.Split(rel, string(filepath.Separator))[0]
+		}
 
-		if err != nil {
-			msg.err = err
+		rename := func() tea.Msg {
+			// a replaced file goes to the trash, so that undo can bring it back.
+			// it is restored if the rename fails
+			var replaced []trashItem
+			if _, err := os.Lstat(to); err == nil && !sameFile(from, to) {
+				item, err := trashPath(to)
+				if err != nil {
+					msg.err = err
+					return msg
+				}
+				replaced = append(replaced, item)
+			}
+			msg.err = os.Rename(from, to)
+			if msg.err != nil {
+				for _, item := range replaced {
+					item.restore()
+				}
+				return msg
+			}
+			msg.entry = renameEntry([]renamePair{{from: from, to: to}})
+			msg.entry.Replaced = replaced
 			return msg
 		}
+		// on a case insensitive filesystem, to can be from itself
+		if _, err := os.Lstat(to); err == nil && confirmOverwrite && !sameFile(from, to) {
+			return promptMsg{yesNoPrompt(fmt.Sprintf("overwrite %v?", withTilde(to)), rename)}
+		}
+		return rename()
+	}
+}
 
-		_, err = os.Stat(path)
+func refreshFiles(path string) tea.Cmd {
+	return refreshFilesFocus(path, "")
+}
+
+// refresh and put the cursor on the file with the name
+func refreshFilesFocus(path string, focus string) tea.Cmd {
+	return func() tea.Msg {
+		var msg filesRefreshMsg
+
+		_, err := os.Stat(path)
 		if os.IsNotExist(err) {
 			msg.err = fmt.Errorf("directory %v does not exists", path)
-			return err
+			return msg
 		}
 
 		msg.cwd = path
+		msg.focus = focus
 
 		entries, err := os.ReadDir(path)
 		if err != nil {
@@ -147,22 +278,42 @@ func refreshFiles(path string) tea.Cmd {
 				IsDir:    info.IsDir(),
 			}
 			file.Path = filepath.Join(path, file.Name)
+			if file.Mode&fs.ModeSymlink != 0 {
+				file.readLink()
+			}
 			msg.files = append(msg.files, file)
 		}
 		return msg
 	}
 }
 
-func openCmd(program string, args ...string) tea.Cmd {
-	cmd := tea.ExecProcess(exec.Command(program, args...), func(err error) tea.Msg {
+// run cmd in the terminal. its output goes to the terminal itself: tea would give it
+// the output of the program, which is not a file
+func execCmd(cmd *exec.Cmd, fn tea.ExecCallback) tea.Cmd {
+	cmd.Stdout = os.Stderr
+	return tea.ExecProcess(cmd, fn)
+}
+
+// run argv, a program and its arguments from the config, with more arguments
+func openCmd(argv []string, args ...string) tea.Cmd {
+	cmd := execCmd(exec.Command(argv[0], append(argv[1:len(argv):len(argv)], args...)...), func(err error) tea.Msg {
 		return processFininishedMsg{err}
 	})
 	return cmd
 }
 
-func openExternalCmd(program string, args ...string) tea.Cmd {
+// run a user command in the terminal with extra environment variables
+func runCmd(argv []string, env []string) tea.Cmd {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	return execCmd(cmd, func(err error) tea.Msg {
+		return processFininishedMsg{err}
+	})
+}
+
+func openExternalCmd(argv []string, args ...string) tea.Cmd {
 	return func() tea.Msg {
-		err := exec.Command(program, args...).Start()
+		err := exec.Command(argv[0], append(argv[1:len(argv):len(argv)], args...)...).Start()
 		return processFininishedMsg{err}
 	}
 }
@@ -1,120 +1,420 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/alecthomas/chroma/v2/styles"
 )
 
 type config struct {
-	editor      string
-	opener      string
-	dirsfirst   bool
-	dirsonly    bool
-	cyclescroll bool
-	preview     bool
-	sort        SortType
-	showhidden  bool
-	// keys map[string]string // TODO: key parser & action methods methods
-	// colors struct{} // TODO
-	// icons map[string]string // TODO
+	editor       []string // program and arguments
+	opener       []string
+	dirsfirst    bool
+	dirsonly     bool
+	cyclescroll  bool
+	preview      bool
+	sort         SortType
+	showhidden   bool
+	autoreload   bool        // source the config again when it changes
+	confirm      set[string] // operations that are confirmed with a prompt
+	conflict     ConflictPolicy
+	filtermode   FilterMode
+	ignore       []string // globs of names that the finder skips
+	keys         keymap
+	theme        theme
+	colors       [][]string // arguments of color lines, applied over any theme
+	previewtheme string     // chroma style of previews, or none
+	imagepreview ImageProtocol
+	lscolors     *lsColors           // nil if disabled or LS_COLORS is not set
+	icons        *iconSet            // built-in set; no icons if it is nil
+	iconsOwn     iconSet             // overrides from the config
+	cmds         map[string][]string // user commands by name
 }
 
-func syntaxErr(lineNr int, line []string, expl string) error {
-	return fmt.Errorf("line %d: syntax error: %v: %v", lineNr, expl, line)
+// a setting of set, unset and toggle
+type option struct {
+	set    func(c *config, args []string) error
+	toggle func(c *config) // nil for non-boolean options
+	reset  func(c *config, def *config)
 }
 
-func (self *config) source(path string) error {
-	file, err := os.Open(path)
-	if err != nil {
-		return err
+func boolOption(field func(c *config) *bool) option {
+	return option{
+		set: func(c *config, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected a boolean")
+			}
+			b, err := strconv.ParseBool(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid boolean %v", args[0])
+			}
+			*field(c) = b
+			return nil
+		},
+		toggle: func(c *config) { *field(c) = !*field(c) },
+		reset:  func(c *config, def *config) { *field(c) = *field(def) },
 	}
-	defer file.Close()
+}
 
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
+// an option with a single value
+func valueOption(set func(c *config, value string) error, reset func(c *config, def *config)) option {
+	return option{
+		set: func(c *config, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected one value, got %d", len(args))
+			}
+			return set(c, args[0])
+		},
+		reset: reset,
+	}
+}
 
-	lineNr := 0
-	for scanner.Scan() {
-		lineNr++
-		line := scanner.Text()
-		tokens := strings.Fields(line)
+// comma separated or separate words
+func listArgs(args []string) (list []string) {
+	for _, arg := range args {
+		for _, item := range strings.Split(arg, ",") {
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
 
-		if len(tokens) == 0 || tokens[0] == "#" {
-			continue
+var options = map[string]option{
+	"editor": {
+		set: func(c *config, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("expected a program")
+			}
+			c.editor = args
+			return nil
+		},
+		reset: func(c *config, def *config) { c.editor = def.editor },
+	},
+	"opener": {
+		set: func(c *config, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("expected a program")
+			}
+			c.opener = args
+			return nil
+		},
+		reset: func(c *config, def *config) { c.opener = def.opener },
+	},
+	"cyclescroll": boolOption(func(c *config) *bool { return &c.cyclescroll }),
+	"dirsfirst":   boolOption(func(c *config) *bool { return &c.dirsfirst }),
+	"preview":     boolOption(func(c *config) *bool { return &c.preview }),
+	"dirsonly":    boolOption(func(c *config) *bool { return &c.dirsonly }),
+	"showhidden":  boolOption(func(c *config) *bool { return &c.showhidden }),
+	"autoreload":  boolOption(func(c *config) *bool { return &c.autoreload }),
+	"lscolors": {
+		set: func(c *config, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected a boolean")
+			}
+			b, err := strconv.ParseBool(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid boolean %v", args[0])
+			}
+			c.lscolors = nil
+			if b {
+				c.lscolors = lsColorsFromEnv()
+			}
+			return nil
+		},
+		toggle: func(c *config) {
+			if c.lscolors != nil {
+				c.lscolors = nil
+			} else {
+				c.lscolors = lsColorsFromEnv()
+			}
+		},
+		reset: func(c *config, def *config) { c.lscolors = def.lscolors },
+	},
+	"confirm": {
+		set: func(c *config, args []string) error {
+			confirm := make(set[string])
+			for _, op := range listArgs(args) {
+				if op == "none" {
+					continue
+				}
+				if !confirmableOps.Contains(op) {
+					return fmt.Errorf("invalid operation %v", op)
+				}
+				confirm.Add(op)
+			}
+			c.confirm = confirm
+			return nil
+		},
+		reset: func(c *config, def *config) { c.confirm = def.confirm },
+	},
+	"ignore": {
+		set: func(c *config, args []string) error {
+			var ignore []string
+			for _, glob := range listArgs(args) {
+				if glob == "none" {
+					continue
+				}
+				if _, err := filepath.Match(glob, ""); err != nil {
+					return fmt.Errorf("invalid glob %v", glob)
+				}
+				ignore = append(ignore, glob)
+			}
+			c.ignore = ignore
+			return nil
+		},
+		reset: func(c *config, def *config) { c.ignore = def.ignore },
+	},
+	"conflict": valueOption(func(c *config, value string) error {
+		conflict, ok := parseConflictPolicy(value)
+		if !ok {
+			return fmt.Errorf("invalid conflict policy %v", value)
 		}
-		// The parser is extremely dumb i couldnt care less
-		if len(tokens) != 2 {
-			return syntaxErr(lineNr, tokens, "expected key value pair")
+		c.conflict = conflict
+		return nil
+	}, func(c *config, def *config) { c.conflict = def.conflict }),
+	"filtermode": valueOption(func(c *config, value string) error {
+		mode, ok := parseFilterMode(value)
+		if !ok {
+			return fmt.Errorf("invalid filter mode %v", value)
 		}
-		switch tokens[0] {
-		case "editor":
-			self.editor = tokens[1]
+		c.filtermode = mode
+		return nil
+	}, func(c *config, def *config) { c.filtermode = def.filtermode }),
+	"sort": valueOption(func(c *config, value string) error {
+		switch value {
+		case "name":
+			c.sort = SortName
+		case "modified":
+			c.sort = SortModified
+		case "size":
+			c.sort = SortSize
+		default:
+			return fmt.Errorf("invalid sorting method %v", value)
+		}
+		return nil
+	}, func(c *config, def *config) { c.sort = def.sort }),
+	"icons": valueOption(func(c *config, value string) error {
+		if value == "none" {
+			c.icons = nil
+			return nil
+		}
+		icons, ok := iconSetByName(value)
+		if !ok {
+			return fmt.Errorf("invalid icon set %v", value)
+		}
+		c.icons = &icons
+		return nil
+	}, func(c *config, def *config) { c.icons = def.icons }),
+	"previewtheme": valueOption(func(c *config, value string) error {
+		if _, ok := styles.Registry[value]; !ok && value != "none" {
+			return fmt.Errorf("unknown preview theme %v", value)
+		}
+		c.previewtheme = value
+		return nil
+	}, func(c *config, def *config) { c.previewtheme = def.previewtheme }),
+	"imagepreview": valueOption(func(c *config, value string) error {
+		protocol, ok := parseImageProtocol(value)
+		if !ok {
+			return fmt.Errorf("invalid image preview %v", value)
+		}
+		c.imagepreview = protocol
+		return nil
+	}, func(c *config, def *config) { c.imagepreview = def.imagepreview }),
+	"theme": valueOption(func(c *config, value string) error {
+		theme, err := loadTheme(value)
+		if err != nil {
+			return err
+		}
+		c.theme = theme
+		c.applyColors()
+		return nil
+	}, func(c *config, def *config) {
+		c.theme = def.theme
+		c.applyColors()
+	}),
+}
 
-		case "opener":
-			self.opener = tokens[1]
+// color lines stay when the theme is changed after them
+func (self *config) applyColors() {
+	for _, args := range self.colors {
+		self.theme.set(args)
+	}
+}
 
-		case "cyclescroll":
-			cyclescroll, err := strconv.ParseBool(tokens[1])
+// nesting limit of source, against files that source each other
+const maxSourceDepth = 16
 
-			if err != nil {
-				return syntaxErr(lineNr, tokens, "invalid boolean")
-			}
-			self.cyclescroll = cyclescroll
+// run the commands of the file. every command runs even if some fail; all errors are returned
+func (self *config) source(path string) []error {
+	return self.sourceFile(path, 0)
+}
 
-		case "dirsfirst":
-			dirsfirst, err := strconv.ParseBool(tokens[1])
+func (self *config) sourceFile(path string, depth int) []error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return []error{err}
+	}
+	commands, lexErrs := lexConfig(path, string(content))
+	var errs []error
+	for _, command := range commands {
+		// in the order of lines
+		for len(lexErrs) > 0 && lexErrs[0].(configError).line < command[0].line {
+			errs, lexErrs = append(errs, lexErrs[0]), lexErrs[1:]
+		}
+		errs = append(errs, self.run(path, command, depth)...)
+	}
+	return append(errs, lexErrs...)
+}
 
-			if err != nil {
-				return syntaxErr(lineNr, tokens, "invalid boolean")
-			}
-			self.dirsfirst = dirsfirst
+func argsOf(tokens []token) []string {
+	args := make([]string, len(tokens))
+	for i, token := range tokens {
+		args[i] = token.text
+	}
+	return args
+}
 
-		case "preview":
-			preview, err := strconv.ParseBool(tokens[1])
+// run a config command. a bare "option value" is the same as "set option value"
+func (self *config) run(file string, command []token, depth int) []error {
+	name := command[0]
+	args := command[1:]
+	// error at a token, or at the command if it is missing
+	errAt := func(i int, format string, a ...any) []error {
+		at := name
+		if i < len(command) {
+			at = command[i]
+		}
+		return []error{configError{file, at.line, at.col, fmt.Sprintf(format, a...)}}
+	}
 
-			if err != nil {
-				return syntaxErr(lineNr, tokens, "invalid boolean")
-			}
-			self.preview = preview
+	switch name.text {
+	case "set":
+		if len(args) == 0 {
+			return errAt(0, "expected set <option> <value>")
+		}
+		return self.set(file, args[0], args[1:])
 
-		case "dirsonly":
-			dirsonly, err := strconv.ParseBool(tokens[1])
+	case "unset":
+		if len(args) != 1 {
+			return errAt(0, "expected unset <option>")
+		}
+		option, ok := options[args[0].text]
+		if !ok {
+			return errAt(1, "unknown option %v", args[0].text)
+		}
+		def := initConfig()
+		option.reset(self, &def)
 
-			if err != nil {
-				return syntaxErr(lineNr, tokens, "invalid boolean")
-			}
-			self.dirsonly = dirsonly
+	case "toggle":
+		if len(args) != 1 {
+			return errAt(0, "expected toggle <option>")
+		}
+		option, ok := options[args[0].text]
+		if !ok {
+			return errAt(1, "unknown option %v", args[0].text)
+		}
+		if option.toggle == nil {
+			return errAt(1, "%v is not a boolean option", args[0].text)
+		}
+		option.toggle(self)
 
-		case "showhidden":
-			nohidden, err := strconv.ParseBool(tokens[1])
+	case "source":
+		if len(args) != 1 {
+			return errAt(0, "expected source <file>")
+		}
+		if depth >= maxSourceDepth {
+			return errAt(0, "source is nested too deep")
+		}
+		path := args[0].text
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return errAt(1, "%v", err)
+		}
+		return self.sourceFile(path, depth+1)
 
-			if err != nil {
-				return syntaxErr(lineNr, tokens, "invalid boolean")
-			}
-			self.showhidden = nohidden
-
-		case "sort":
-			switch tokens[1] {
-			case "name":
-				self.sort = SortName
-			case "modified":
-				self.sort = SortModified
-			case "size":
-				self.sort = SortSize
-			default:
-				return syntaxErr(lineNr, tokens, "invalid sorting method")
-			}
+	case "map":
+		if len(args) < 2 || len(args) > 3 {
+			return errAt(0, "expected map <keys> <action> [arg]")
+		}
+		keys, err := parseKeys(args[0].text)
+		if err != nil {
+			return errAt(1, "%v", err)
+		}
+		var arg string
+		if len(args) == 3 {
+			arg = args[2].text
+		}
+		if err := self.keys.bind(keys, args[1].text, arg); err != nil {
+			return errAt(2, "%v", err)
+		}
 
-		default:
-			return syntaxErr(lineNr, tokens, "invalid key")
+	case "unmap":
+		if len(args) != 1 {
+			return errAt(0, "expected unmap <keys>")
+		}
+		keys, err := parseKeys(args[0].text)
+		if err != nil {
+			return errAt(1, "%v", err)
+		}
+		if err := self.keys.unbind(keys); err != nil {
+			return errAt(1, "%v", err)
+		}
+
+	case "color":
+		if err := self.theme.set(argsOf(args)); err != nil {
+			return errAt(1, "%v", err)
+		}
+		self.colors = append(self.colors, argsOf(args))
+
+	case "icon":
+		if err := self.iconsOwn.set(argsOf(args)); err != nil {
+			return errAt(1, "%v", err)
+		}
+
+	case "cmd":
+		if len(args) < 2 {
+			return errAt(0, "expected cmd <name> <program> [args...]")
+		}
+		self.cmds[args[0].text] = argsOf(args[1:])
+
+	default:
+		return self.set(file, name, args)
+	}
+	return nil
+}
+
+func (self *config) set(file string, name token, args []token) []error {
+	option, ok := options[name.text]
+	if !ok {
+		return []error{configError{file, name.line, name.col, fmt.Sprintf("unknown option %v", name.text)}}
+	}
+	if err := option.set(self, argsOf(args)); err != nil {
+		at := name
+		if len(args) > 0 {
+			at = args[0]
 		}
+		return []error{configError{file, at.line, at.col, err.Error()}}
 	}
 	return nil
 }
 
+var confirmableOps = set[string]{
+	"copy":      {},
+	"move":      {},
+	"overwrite": {}, // single rename
+	"rename":    {}, // bulk rename
+	"trash":     {},
+	"delete":    {},
+}
+
 func envOr(variable string, def string) string {
 	if v := os.Getenv(variable); v == "" {
 		return def
@@ -123,15 +423,36 @@ func envOr(variable string, def string) string {
 	}
 }
 
+// a program with arguments from the variable, like EDITOR="code --wait"
+func envArgs(variable string, def string) []string {
+	if args := strings.Fields(os.Getenv(variable)); len(args) > 0 {
+		return args
+	}
+	return []string{def}
+}
+
 func initConfig() (c config) {
-	c.editor = envOr("EDITOR", "nvim")
-	c.opener = envOr("OPENER", "xdg-open")
+	c.editor = envArgs("EDITOR", "nvim")
+	c.opener = envArgs("OPENER", "xdg-open")
 	c.cyclescroll = true
 	c.dirsfirst = true
 	c.dirsonly = false
 	c.preview = true
 	c.showhidden = false
 	c.sort = SortName
+	c.confirm = set[string]{"overwrite": {}, "trash": {}, "delete": {}}
+	c.conflict = ConflictAsk
+	c.filtermode = FilterSubstring
+	c.ignore = []string{".git", "node_modules"}
+	c.keys = defaultKeymap()
+	c.theme = darkTheme()
+	c.previewtheme = "monokai"
+	c.imagepreview = ImageAuto
+	c.lscolors = lsColorsFromEnv()
+	icons := nerdIcons()
+	c.icons = &icons
+	c.iconsOwn = newIconSet()
+	c.cmds = make(map[string][]string)
 
 	return
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// what to do when the destination of a copy or move already exists
+type ConflictPolicy byte
+
+const (
+	ConflictAsk ConflictPolicy = iota
+	ConflictOverwrite
+	ConflictSkip
+	ConflictRename // file (1).txt
+	ConflictNewer  // overwrite if the source is newer
+)
+
+func parseConflictPolicy(s string) (ConflictPolicy, bool) {
+	switch s {
+	case "ask":
+		return ConflictAsk, true
+	case "overwrite":
+		return ConflictOverwrite, true
+	case "skip":
+		return ConflictSkip, true
+	case "rename":
+		return ConflictRename, true
+	case "newer":
+		return ConflictNewer, true
+	}
+	return ConflictAsk, false
+}
+
+var conflictKeys = map[string]ConflictPolicy{
+	"o": ConflictOverwrite,
+	"s": ConflictSkip,
+	"r": ConflictRename,
+	"n": ConflictNewer,
+}
+
+var conflictChoices = []choice{
+	{"o", "overwrite"},
+	{"s", "skip"},
+	{"r", "rename"},
+	{"n", "if newer"},
+}
+
+// first free name like "file (1).txt" in the directory of path
+func uniqueName(path string) string {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	// .bashrc has no extension
+	if stem == "" {
+		stem, ext = base, ""
+	}
+	for i := 1; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+		if _, err := os.Lstat(candidate); err != nil {
+			return candidate
+		}
+	}
+}
+
+// ask the user what to do with dst. an uppercase answer applies to the rest of the operation
+func (self *fileop) askConflict(dst string) ConflictPolicy {
+	p := choicePrompt(fmt.Sprintf("%v exists (uppercase for all):", withTilde(dst)), conflictChoices, nil)
+	answer, ok := self.ask(p)
+	if !ok {
+		return ConflictSkip
+	}
+	policy := conflictKeys[strings.ToLower(answer)]
+	if unicode.IsUpper(rune(answer[0])) {
+		self.policy = policy
+	}
+	return policy
+}
+
+// a free hidden name next to path, for writing a file before it replaces path
+func tempName(path string) string {
+	dir, base := filepath.Split(path)
+	for i := 0; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf(".%s.bubblefm-%d-%d", base, os.Getpid(), i))
+		if _, err := os.Lstat(candidate); err != nil {
+			return candidate
+		}
+	}
+}
+
+// whether the paths name the same file, or src is a symlink to dst
+func sameFile(src, dst string) bool {
+	a, errA := os.Lstat(src)
+	b, errB := os.Lstat(dst)
+	if errA == nil && errB == nil && os.SameFile(a, b) {
+		return true
+	}
+	a, errA = os.Stat(src)
+	b, errB = os.Stat(dst)
+	return errA == nil && errB == nil && os.SameFile(a, b)
+}
+
+// put tmp in place of dst. dst goes to the trash, so that undo can bring it back,
+// and it is restored if tmp cannot be put in its place
+func replace(tmp, dst string) (trashItem, error) {
+	item, err := trashPath(dst)
+	if err != nil {
+		return item, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		item.restore()
+		return trashItem{}, err
+	}
+	return item, nil
+}
+
+// decide where src goes if dst exists. returns errSkipped if it should not be touched.
+// to overwrite dst, src is written to the returned temporary name, which then replaces dst
+func (self *fileop) resolve(src, dst string) (target string, overwrite bool, err error) {
+	dstInfo, err := os.Lstat(dst)
+	if err != nil {
+		return dst, false, nil
+	}
+	policy := self.policy
+	if policy == ConflictAsk {
+		policy = self.askConflict(dst)
+	}
+	if policy == ConflictNewer {
+		srcInfo, err := os.Lstat(src)
+		if err != nil {
+			return "", false, err
+		}
+		policy = ConflictSkip
+		if srcInfo.ModTime().After(dstInfo.ModTime()) {
+			policy = ConflictOverwrite
+		}
+	}
+
+	switch policy {
+	case ConflictOverwrite:
+		if src == dst || sameFile(src, dst) {
+			return "", false, fmt.Errorf("%v: source and destination are the same file", src)
+		}
+		realSrc, errSrc := filepath.EvalSymlinks(src)
+		realDst, errDst := filepath.EvalSymlinks(dst)
+		if isInside(src, dst) || errSrc == nil && errDst == nil && isInside(realSrc, realDst) {
+			return "", false, fmt.Errorf("%v: cannot overwrite a directory with its own content", dst)
+		}
+		return tempName(dst), true, nil
+	case ConflictRename:
+		return uniqueName(dst), false, nil
+	default:
+		return "", false, errSkipped
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUniqueName(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "", "a (1).txt": "", ".bashrc": "", "b.tar.gz": ""})
+	tests := []struct{ name, want string }{
+		{"a.txt", "a (2).txt"},
+		{".bashrc", ".bashrc (1)"},
+		{"b.tar.gz", "b.tar (1).gz"},
+		{"c", "c (1)"},
+	}
+	for _, test := range tests {
+		if got := uniqueName(filepath.Join(dir, test.name)); got != filepath.Join(dir, test.want) {
+			t.Errorf("uniqueName(%q) = %q, want %q", test.name, filepath.Base(got), test.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"old": "", "new": "", "dst/old": "", "dst/new": "", "src/x": ""})
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{"old", "dst/new"} {
+		if err := os.Chtimes(filepath.Join(dir, name), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("old", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		policy    ConflictPolicy
+		src, dst  string
+		target    string // "temp" for a temporary name next to dst
+		overwrite bool
+		err       string
+	}{
+		{ConflictSkip, "new", "missing", "missing", false, ""},
+		{ConflictSkip, "new", "dst/new", "", false, "skipped"},
+		{ConflictRename, "new", "dst/new", "dst/new (1)", false, ""},
+		{ConflictOverwrite, "new", "dst/new", "temp", true, ""},
+		{ConflictNewer, "new", "dst/new", "temp", true, ""},
+		{ConflictNewer, "old", "dst/old", "", false, "skipped"},
+		{ConflictOverwrite, "old", "old", "", false, "same file"},
+		{ConflictOverwrite, "link", "old", "", false, "same file"},
+		{ConflictOverwrite, "src/x", "src", "", false, "its own content"},
+	}
+	for _, test := range tests {
+		op := newFileop("copying")
+		op.policy = test.policy
+		dst := filepath.Join(dir, test.dst)
+		target, overwrite, err := op.resolve(filepath.Join(dir, test.src), dst)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v over %v: error %v, want %q", test.src, test.dst, err, test.err)
+			}
+			if test.err == "skipped" && !errors.Is(err, errSkipped) {
+				t.Errorf("%v over %v: error %v is not errSkipped", test.src, test.dst, err)
+			}
+			continue
+		}
+		want := filepath.Join(dir, test.target)
+		if test.target == "temp" {
+			want = filepath.Dir(dst)
+			target = filepath.Dir(target)
+		}
+		if err != nil || target != want || overwrite != test.overwrite {
+			t.Errorf("%v over %v: %v, %v, %v, want %v, %v", test.src, test.dst, target, overwrite, err, want, test.overwrite)
+		}
+	}
+}
+
+// the replaced file goes to the trash, and comes back if the new one cannot take its place
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, ".data"))
+	writeFiles(t, dir, map[string]string{"a": "old", "tmp": "new"})
+	item, err := replace(filepath.Join(dir, "tmp"), filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFiles(t, dir); got["a"] != "new" || got[".data/Trash/files/a"] != "old" || item.Original != filepath.Join(dir, "a") {
+		t.Errorf("got %v, trashed %+v", got, item)
+	}
+
+	if _, err := replace(filepath.Join(dir, "missing"), filepath.Join(dir, "a")); err == nil {
+		t.Errorf("no error")
+	}
+	if got := readFiles(t, dir); got["a"] != "new" {
+		t.Errorf("got %v", got)
+	}
+}
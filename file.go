@@ -2,14 +2,42 @@ package main
 
 import (
 	"io/fs"
+	"os"
+	"path/filepath"
 	"time"
 )
 
 type File struct {
 	Name     string
 	Path     string
-	IsDir    bool
+	IsDir    bool // for symlinks, whether the target is a directory
 	Size     int64
 	Modified time.Time
 	Mode     fs.FileMode
+
+	IsLink     bool
+	LinkTarget string      // as stored in the link, may be relative
+	Broken     bool        // the target does not exist
+	TargetMode fs.FileMode // mode of the resolved target
+}
+
+// fill link fields by following the symlink at file.Path
+func (self *File) readLink() {
+	self.IsLink = true
+	self.LinkTarget, _ = os.Readlink(self.Path)
+	info, err := os.Stat(self.Path)
+	if err != nil {
+		self.Broken = true
+		return
+	}
+	self.IsDir = info.IsDir()
+	self.TargetMode = info.Mode()
+}
+
+// absolute path of the link target
+func (self File) targetPath() string {
+	if filepath.IsAbs(self.LinkTarget) {
+		return filepath.Clean(self.LinkTarget)
+	}
+	return filepath.Join(filepath.Dir(self.Path), self.LinkTarget)
 }
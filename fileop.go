@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/sys/unix"
+)
+
+// sent by a running file operation to report its progress
+type progressMsg struct {
+	ch    <-chan tea.Msg
+	id    int
+	op    string
+	file  string
+	done  int64
+	total int64
+	count bool // done and total are numbers of files, not bytes
+}
+
+func (self progressMsg) String() string {
+	if self.file == "" {
+		return self.op
+	}
+	if self.count {
+		return fmt.Sprintf("%s %s (%d/%d)", self.op, filepath.Base(self.file), self.done, self.total)
+	}
+	percent := 100
+	if self.total > 0 {
+		percent = int(self.done * 100 / self.total)
+	}
+	return fmt.Sprintf("%s %s: %s/%s (%d%%)",
+		self.op, filepath.Base(self.file), humanSize(self.done), humanSize(self.total), percent)
+}
+
+// sent by a running file operation that waits for an answer from the user
+type askMsg struct {
+	ch     <-chan tea.Msg
+	prompt *prompt
+}
+
+// receives the next message of a running file operation
+func listenCmd(ch <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+// a long running file operation that reports to the ui through a channel
+type fileop struct {
+	id     int
+	name   string
+	ch     chan tea.Msg
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	file  string
+	done  int64
+	total int64
+	count bool
+
+	policy ConflictPolicy // for existing destinations
+
+	// for the journal
+	created  []string
+	renamed  []renamePair
+	replaced []trashItem // overwritten destinations
+}
+
+// returned for files that the user chose not to touch
+var errSkipped = errors.New("skipped")
+
+func newFileop(name string) *fileop {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &fileop{
+		id:   nextJobId(),
+		name: name,
+		// buffered, so that progress reports don't wait for the ui
+		ch:     make(chan tea.Msg, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// report progress, dropping the message if the ui has not read the previous one yet
+func (self *fileop) report() {
+	msg := progressMsg{self.ch, self.id, self.name, self.file, self.done, self.total, self.count}
+	select {
+	case self.ch <- msg:
+	default:
+	}
+}
+
+// runs the operation in background as a job. fn's message is delivered when the job is done
+func (self *fileop) start(fn func() (tea.Msg, error)) tea.Cmd {
+	return func() tea.Msg {
+		go func() {
+			msg, err := fn()
+			self.cancel()
+			self.ch <- jobDoneMsg{self.id, err, msg}
+		}()
+		return jobStartedMsg{self.id, self.name, self.cancel, self.ch}
+	}
+}
+
+type promptAnswer struct {
+	answer string
+	ok     bool
+}
+
+// open the prompt and wait until it is answered
+func (self *fileop) ask(p *prompt) (answer string, ok bool) {
+	reply := make(chan promptAnswer, 1)
+	p.then = func(answer string, ok bool) tea.Cmd {
+		return func() tea.Msg {
+			reply <- promptAnswer{answer, ok}
+			return nil
+		}
+	}
+	self.ch <- askMsg{self.ch, p}
+	select {
+	case a := <-reply:
+		return a.answer, a.ok
+	case <-self.ctx.Done():
+		return "", false
+	}
+}
+
+// total size of regular files in the trees
+func (self *fileop) measure(paths []string) {
+	for _, path := range paths {
+		filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if entry.Type().IsRegular() {
+				if info, err := entry.Info(); err == nil {
+					self.total += info.Size()
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// io.Writer that counts copied bytes
+type progressWriter struct {
+	w  io.Writer
+	op *fileop
+}
+
+func (self progressWriter) Write(p []byte) (int, error) {
+	if err := self.op.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := self.w.Write(p)
+	self.op.done += int64(n)
+	self.op.report()
+	return n, err
+}
+
+// copy every path into dir; errors are collected per path
+func (self *fileop) copyAll(paths []string, dir string) error {
+	self.measure(paths)
+	var errs []error
+	for _, src := range paths {
+		if err := self.ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		dst := filepath.Join(dir, filepath.Base(src))
+		if err := self.copyPath(src, dst); err != nil && err != errSkipped {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func isInside(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// recursively copy src to dst, keeping mode bits, mtimes and symlinks
+func (self *fileop) copyPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && isInside(filepath.Dir(dst), src) {
+		return fmt.Errorf("%v: cannot copy a directory into itself", src)
+	}
+	target, overwrite, err := self.resolve(src, dst)
+	if err != nil {
+		return err
+	}
+	if err := self.copyTree(src, target, info); err != nil {
+		if overwrite {
+			os.RemoveAll(target)
+			return err
+		}
+		// the files that were copied are kept, and can be undone
+		if info.IsDir() && exists(target) {
+			self.created = append(self.created, target)
+			return fmt.Errorf("%v: copied partially to %v: %w", src, target, err)
+		}
+		return err
+	}
+	if overwrite {
+		item, err := replace(target, dst)
+		if err != nil {
+			os.RemoveAll(target)
+			return err
+		}
+		self.replaced = append(self.replaced, item)
+		target = dst
+	}
+	self.created = append(self.created, target)
+	return nil
+}
+
+// files that fail are reported, and their siblings are still copied
+func (self *fileop) copyTree(src, dst string, info fs.FileInfo) error {
+	if err := self.ctx.Err(); err != nil {
+		return err
+	}
+	self.file = src
+	self.report()
+
+	switch mode := info.Mode(); {
+	case mode&fs.ModeSymlink != 0:
+		return copySymlink(src, dst, info)
+
+	case mode.IsDir():
+		if err := os.MkdirAll(dst, 0700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		var errs []error
+		for _, entry := range entries {
+			if err := self.ctx.Err(); err != nil {
+				errs = append(errs, err)
+				break
+			}
+			info, err := entry.Info()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			err = self.copyTree(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), info)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		// after the children, because creating them changes mtime
+		if err := copyAttrs(dst, info); err != nil {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+
+	case mode.IsRegular():
+		return self.copyFile(src, dst, info)
+
+	default:
+		return fmt.Errorf("%v: cannot copy file of type %v", src, mode.Type())
+	}
+}
+
+func (self *fileop) copyFile(src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// an existing symlink would be followed by os.OpenFile
+	if info, err := os.Lstat(dst); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(progressWriter{out, self}, in); err != nil {
+		// don't leave half of a file behind
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return copyAttrs(dst, info)
+}
+
+func copySymlink(src, dst string, info fs.FileInfo) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+	mtime := unix.NsecToTimespec(info.ModTime().UnixNano())
+	return unix.UtimesNanoAt(unix.AT_FDCWD, dst, []unix.Timespec{mtime, mtime}, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// permission bits and modification time
+func copyAttrs(dst string, info fs.FileInfo) error {
+	mode := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	if err := os.Chmod(dst, mode); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// move every path into dir. returns the paths that were moved; errors are collected per path
+func (self *fileop) moveAll(paths []string, dir string) (moved []string, err error) {
+	var errs []error
+	for _, src := range paths {
+		if err := self.ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		dst := filepath.Join(dir, filepath.Base(src))
+		err := self.movePath(src, dst)
+		if err == errSkipped {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		moved = append(moved, src)
+	}
+	return moved, errors.Join(errs...)
+}
+
+// rename src to dst, or copy and delete it if they are on different filesystems
+func (self *fileop) movePath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && isInside(filepath.Dir(dst), src) {
+		return fmt.Errorf("%v: cannot move a directory into itself", src)
+	}
+	target, overwrite, err := self.resolve(src, dst)
+	if err != nil {
+		return err
+	}
+	self.file = src
+	self.report()
+
+	err = os.Rename(src, target)
+	if errors.Is(err, unix.EXDEV) {
+		err = self.moveAcross(src, target, info)
+	}
+	if err == nil && overwrite {
+		var item trashItem
+		if item, err = replace(target, dst); err == nil {
+			self.replaced = append(self.replaced, item)
+		} else {
+			// back where it was
+			if exists(src) {
+				os.RemoveAll(target)
+			} else if os.Rename(target, src) != nil {
+				return fmt.Errorf("%v: moved to %v, but: %w", src, target, err)
+			}
+		}
+		target = dst
+	}
+	if err == nil {
+		self.renamed = append(self.renamed, renamePair{from: src, to: target})
+	}
+	return err
+}
+
+// copy and delete, for moves to another filesystem. only the files that were
+// copied are deleted; if none were, the partial copy is removed
+func (self *fileop) moveAcross(src, dst string, info fs.FileInfo) error {
+	self.measure([]string{src})
+	copyErr := self.copyTree(src, dst, info)
+	whole, some, err := removeCopied(src, dst, info)
+	switch {
+	case whole && copyErr == nil:
+		return nil
+	case whole:
+		return fmt.Errorf("%v: moved to %v, but: %w", src, dst, copyErr)
+	case copyErr != nil:
+		err = fmt.Errorf("copying to another device: %w", copyErr)
+	default:
+		err = fmt.Errorf("not deleted, copy differs: %w", err)
+	}
+	if !some {
+		os.RemoveAll(dst)
+		return fmt.Errorf("%v: %w", src, err)
+	}
+	return fmt.Errorf("%v: moved partially to %v: %w", src, dst, err)
+}
+
+// delete the files of src that have the same copy in dst, and the directories
+// that become empty. whole is true if src is gone, some if anything was deleted
+func removeCopied(src, dst string, info fs.FileInfo) (whole, some bool, err error) {
+	if !info.IsDir() {
+		if err := verifyCopy(src, dst); err != nil {
+			return false, false, err
+		}
+		if err := os.Remove(src); err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return false, false, err
+	}
+	whole = true
+	var errs []error
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			errs = append(errs, err)
+			whole = false
+			continue
+		}
+		w, s, err := removeCopied(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), info)
+		whole, some = whole && w, some || s
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if whole {
+		if err := verifyCopy(src, dst); err != nil {
+			return false, some, err
+		}
+		if err := os.Remove(src); err != nil {
+			return false, some, err
+		}
+		some = true
+	}
+	return whole, some, errors.Join(errs...)
+}
+
+// check that dst has the same tree as src
+func verifyCopy(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		other := filepath.Join(dst, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		otherInfo, err := os.Lstat(other)
+		if err != nil {
+			return err
+		}
+		if info.Mode().Type() != otherInfo.Mode().Type() {
+			return fmt.Errorf("%v: file type differs", other)
+		}
+		switch {
+		case info.Mode().IsRegular() && info.Size() != otherInfo.Size():
+			return fmt.Errorf("%v: size differs", other)
+		case info.Mode().IsRegular():
+			same, err := sameContents(path, other)
+			if err != nil {
+				return err
+			}
+			if !same {
+				return fmt.Errorf("%v: contents differ", other)
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			otherTarget, err := os.Readlink(other)
+			if err != nil {
+				return err
+			}
+			if target != otherTarget {
+				return fmt.Errorf("%v: link target differs", other)
+			}
+		}
+		return nil
+	})
+}
+
+// whether the files have the same bytes, read back from the disk
+func sameContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufa := make([]byte, 64*1024)
+	bufb := make([]byte, len(bufa))
+	for {
+		na, erra := io.ReadFull(fa, bufa)
+		nb, errb := io.ReadFull(fb, bufb)
+		if !bytes.Equal(bufa[:na], bufb[:nb]) {
+			return false, nil
+		}
+		enda := erra == io.EOF || erra == io.ErrUnexpectedEOF
+		endb := errb == io.EOF || errb == io.ErrUnexpectedEOF
+		switch {
+		case erra != nil && !enda:
+			return false, erra
+		case errb != nil && !endb:
+			return false, errb
+		case enda || endb:
+			return enda && endb, nil
+		}
+	}
+}
+
+// move every path to the trash. returns the paths that were trashed
+func (self *fileop) trashAll(paths []string) (trashed []string, items []trashItem, err error) {
+	self.count = true
+	self.total = int64(len(paths))
+	var errs []error
+	for _, path := range paths {
+		if err := self.ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		self.file = path
+		self.report()
+		item, err := trashPath(path)
+		self.done++
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		trashed = append(trashed, path)
+		items = append(items, item)
+	}
+	return trashed, items, errors.Join(errs...)
+}
+
+// permanently delete every path. returns the paths that were deleted
+func (self *fileop) deleteAll(paths []string) (deleted []string, err error) {
+	self.count = true
+	self.total = int64(len(paths))
+	var errs []error
+	for _, path := range paths {
+		if err := self.ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		self.file = path
+		self.report()
+		err := os.RemoveAll(path)
+		self.done++
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		deleted = append(deleted, path)
+	}
+	return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Type().IsRegular() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel, _ := filepath.Rel(dir, path)
+			files[filepath.ToSlash(rel)] = string(data)
+		}
+		return nil
+	})
+	return files
+}
+
+// a tree with a file, an executable, a symlink and a nested directory
+func makeTree(t *testing.T, dir string) {
+	t.Helper()
+	writeFiles(t, dir, map[string]string{"a": "A", "sub/b": "B", "run": "#!/bin/sh"})
+	if err := os.Chmod(filepath.Join(dir, "run"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/b", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "a"), old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkTree(t *testing.T, dir string) {
+	t.Helper()
+	files := readFiles(t, dir)
+	if files["a"] != "A" || files["sub/b"] != "B" || files["run"] != "#!/bin/sh" {
+		t.Errorf("files %v", files)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "link")); err != nil || target != "sub/b" {
+		t.Errorf("link to %q, %v", target, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "run")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("run is %v, %v", info.Mode(), err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "a")); err != nil || info.ModTime().Year() != 2020 {
+		t.Errorf("a is modified at %v, %v", info.ModTime(), err)
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	makeTree(t, src)
+	info, _ := os.Lstat(src)
+	if err := newFileop("copying").copyTree(src, dst, info); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dst)
+	checkTree(t, src)
+}
+
+// a file that cannot be copied does not stop its siblings
+func TestCopyTreeErrors(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	makeTree(t, src)
+	if err := syscall.Mkfifo(filepath.Join(src, "fifo"), 0644); err != nil {
+		t.Skip(err)
+	}
+	info, _ := os.Lstat(src)
+	err := newFileop("copying").copyTree(src, dst, info)
+	if err == nil || !strings.Contains(err.Error(), "cannot copy file of type") {
+		t.Errorf("error %v", err)
+	}
+	checkTree(t, dst)
+}
+
+func TestVerifyCopy(t *testing.T) {
+	tests := []struct {
+		name  string
+		other map[string]string // files written over the copy
+		link  string            // target of the link in the copy
+		err   string
+	}{
+		{"same", nil, "", ""},
+		{"contents", map[string]string{"sub/b": "X"}, "", "contents differ"},
+		{"size", map[string]string{"a": "AA"}, "", "size differs"},
+		{"link", nil, "a", "link target differs"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+			makeTree(t, src)
+			info, _ := os.Lstat(src)
+			if err := newFileop("copying").copyTree(src, dst, info); err != nil {
+				t.Fatal(err)
+			}
+			writeFiles(t, dst, test.other)
+			if test.link != "" {
+				os.Remove(filepath.Join(dst, "link"))
+				os.Symlink(test.link, filepath.Join(dst, "link"))
+			}
+			err := verifyCopy(src, dst)
+			if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestVerifyCopyMissing(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	makeTree(t, src)
+	info, _ := os.Lstat(src)
+	newFileop("copying").copyTree(src, dst, info)
+	os.Remove(filepath.Join(dst, "sub", "b"))
+	if err := verifyCopy(src, dst); err == nil {
+		t.Errorf("a missing file is not an error")
+	}
+}
+
+func TestSameContents(t *testing.T) {
+	big := strings.Repeat("x", 200*1024)
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"", "", true},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "abcd", false},
+		{big, big, true},
+		{big, big[:len(big)-1] + "y", false},
+		{big, big + "x", false},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"a": test.a, "b": test.b})
+		same, err := sameContents(filepath.Join(dir, "a"), filepath.Join(dir, "b"))
+		if err != nil || same != test.want {
+			t.Errorf("sameContents of %d and %d bytes = %v, %v, want %v", len(test.a), len(test.b), same, err, test.want)
+		}
+	}
+}
+
+func TestMoveAcross(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	makeTree(t, src)
+	info, _ := os.Lstat(src)
+	if err := newFileop("moving").moveAcross(src, dst, info); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dst)
+	if _, err := os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("src is still there: %v", err)
+	}
+}
+
+// files that were not copied stay in the source, with the directories above them
+func TestMoveAcrossPartially(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	makeTree(t, src)
+	if err := syscall.Mkfifo(filepath.Join(src, "sub", "fifo"), 0644); err != nil {
+		t.Skip(err)
+	}
+	info, _ := os.Lstat(src)
+	err := newFileop("moving").moveAcross(src, dst, info)
+	if err == nil || !strings.Contains(err.Error(), "moved partially") {
+		t.Fatalf("error %v", err)
+	}
+	checkTree(t, dst)
+	for _, name := range []string{"a", "run", "link", "sub/b"} {
+		if _, err := os.Lstat(filepath.Join(src, name)); !os.IsNotExist(err) {
+			t.Errorf("%v was not deleted: %v", name, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(src, "sub", "fifo")); err != nil {
+		t.Errorf("fifo was deleted: %v", err)
+	}
+}
+
+// when nothing could be copied, the partial copy is removed
+func TestMoveAcrossNothing(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(src, "fifo"), 0644); err != nil {
+		t.Skip(err)
+	}
+	info, _ := os.Lstat(src)
+	err := newFileop("moving").moveAcross(src, dst, info)
+	if err == nil || strings.Contains(err.Error(), "partially") {
+		t.Errorf("error %v", err)
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("dst is left: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(src, "fifo")); err != nil {
+		t.Errorf("fifo was deleted: %v", err)
+	}
+}
+
+// a copy that differs keeps the source
+func TestRemoveCopied(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	makeTree(t, src)
+	info, _ := os.Lstat(src)
+	newFileop("copying").copyTree(src, dst, info)
+	writeFiles(t, dst, map[string]string{"sub/b": "X"})
+
+	whole, some, err := removeCopied(src, dst, info)
+	if whole || !some || err == nil {
+		t.Errorf("whole %v, some %v, error %v", whole, some, err)
+	}
+	files := readFiles(t, src)
+	if len(files) != 1 || files["sub/b"] != "B" {
+		t.Errorf("left in src: %v", files)
+	}
+}
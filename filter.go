@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type FilterMode byte
+
+const (
+	FilterSubstring FilterMode = iota
+	FilterGlob
+	FilterRegex
+)
+
+var filterModes = []string{"substring", "glob", "regex"}
+
+func (self FilterMode) String() string {
+	return filterModes[self]
+}
+
+func parseFilterMode(s string) (FilterMode, bool) {
+	for i, mode := range filterModes {
+		if s == mode {
+			return FilterMode(i), true
+		}
+	}
+	return 0, false
+}
+
+// narrows the files of a directory by name
+type fileFilter struct {
+	pattern string
+	mode    FilterMode
+	match   func(name string) bool // nil if the pattern is invalid
+	err     error                  // why the pattern is invalid
+}
+
+// the filter for a directory was changed; an empty pattern clears it.
+// an invalid pattern keeps the filter as it was
+type filterMsg struct {
+	dir    string
+	filter fileFilter
+	done   bool // the prompt was closed
+}
+
+// smart case: case sensitive only if the pattern has upper case letters
+func caseSensitive(pattern string) bool {
+	return strings.IndexFunc(pattern, unicode.IsUpper) >= 0
+}
+
+func newFilter(pattern string, mode FilterMode) (f fileFilter) {
+	f.pattern = pattern
+	f.mode = mode
+	fold := !caseSensitive(pattern)
+	switch mode {
+	case FilterSubstring:
+		if fold {
+			pattern = strings.ToLower(pattern)
+		}
+		f.match = func(name string) bool {
+			if fold {
+				name = strings.ToLower(name)
+			}
+			return strings.Contains(name, pattern)
+		}
+
+	case FilterGlob:
+		if fold {
+			pattern = strings.ToLower(pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			f.err = err
+			return
+		}
+		f.match = func(name string) bool {
+			if fold {
+				name = strings.ToLower(name)
+			}
+			ok, _ := filepath.Match(pattern, name)
+			return ok
+		}
+
+	case FilterRegex:
+		if fold {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			f.err = err
+			return
+		}
+		f.match = re.MatchString
+	}
+	return
+}
+
+func (self fileFilter) active() bool {
+	return self.pattern != ""
+}
+
+func (self fileFilter) matches(name string) bool {
+	return self.match(name)
+}
+
+func (self fileFilter) promptText() string {
+	if self.err != nil {
+		return fmt.Sprintf("filter (%v, invalid): ", self.mode)
+	}
+	return fmt.Sprintf("filter (%v): ", self.mode)
+}
+
+// open the filter prompt for the current directory. files are filtered as the pattern is typed,
+// ctrl+t switches the mode and esc brings back the previous filter
+func (self *model) openFilter() {
+	dir := self.cwd
+	previous, ok := self.filters[dir]
+	mode := self.config.filtermode
+	if ok {
+		mode = previous.mode
+	}
+	p := &prompt{
+		kind:    PromptInput,
+		text:    newFilter(previous.pattern, mode).promptText(),
+		input:   newLineEditor(previous.pattern, nil),
+		history: "filter",
+		then: func(answer string, ok bool) tea.Cmd {
+			filter := newFilter(answer, mode)
+			if !ok {
+				filter = previous
+			}
+			return func() tea.Msg {
+				return filterMsg{dir, filter, true}
+			}
+		},
+	}
+	p.live = func(key string, value string) tea.Msg {
+		if key == "ctrl+t" {
+			mode = (mode + 1) % FilterMode(len(filterModes))
+		}
+		filter := newFilter(value, mode)
+		p.text = filter.promptText()
+		return filterMsg{dir, filter, false}
+	}
+	self.openPrompt(p)
+}
+
+func (self *model) onFilter(msg filterMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch {
+	case msg.filter.err != nil:
+		if msg.done {
+			self.status = newStatus(fmt.Sprintf("invalid filter: %v", msg.filter.err), true)
+			cmd = clearStatusCmd(self.status.id)
+		}
+	case msg.filter.active():
+		self.filters[msg.dir] = msg.filter
+	default:
+		delete(self.filters, msg.dir)
+	}
+	if msg.dir != self.cwd {
+		return self, cmd
+	}
+	self.empty = self.len() == 0
+	self.syncCursor()
+	self.syncBounds()
+	model, preview := self.refreshPreview()
+	return model, tea.Batch(cmd, preview)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fuzzy search of files below a directory. the tree is walked in background
+// and found paths are ranked as they come
+
+type fuzzyResult struct {
+	path      string // relative to the root
+	score     int
+	positions []int
+}
+
+type finder struct {
+	id         int
+	root       string
+	input      lineEditor
+	candidates []string
+	results    []fuzzyResult
+	cursor     int
+	walking    bool
+	cancel     context.CancelFunc
+	ranked     string // the query of the results
+	ranking    int    // id of the ranking in background, 0 if there is none
+}
+
+// paths found by the walk
+type finderFoundMsg struct {
+	id    int
+	paths []string
+	ch    <-chan tea.Msg
+}
+
+type finderDoneMsg struct {
+	id  int
+	err error
+}
+
+// results of a query, ranked in background
+type finderRankedMsg struct {
+	id      int
+	query   string
+	results []fuzzyResult
+	scored  int // candidates that were ranked; those found later are not
+}
+
+// limit of walked files, so that finding in / does not eat all memory
+const finderLimit = 500000
+
+func (self *model) openFinder() tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	self.finder = &finder{
+		id:      nextJobId(),
+		root:    self.cwd,
+		input:   newLineEditor("", nil),
+		walking: true,
+		cancel:  cancel,
+	}
+	self.currentView = ViewFinder
+	return walkFinderCmd(ctx, self.finder.id, self.cwd, self.config.showhidden, self.config.ignore)
+}
+
+func (self *model) closeFinder() {
+	self.finder.cancel()
+	self.finder = nil
+	self.currentView = ViewFiles
+}
+
+func walkFinderCmd(ctx context.Context, id int, root string, showhidden bool, ignore []string) tea.Cmd {
+	ch := make(chan tea.Msg, 1)
+	go func() {
+		var batch []string
+		last := time.Now()
+		total := 0
+		// batches are sent every so often, not for every file
+		flush := func() {
+			select {
+			case ch <- finderFoundMsg{id, batch, ch}:
+			case <-ctx.Done():
+			}
+			batch = nil
+			last = time.Now()
+		}
+
+		var visit func(dir string, rules []ignoreRule) error
+		visit = func(dir string, rules []ignoreRule) error {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return nil // unreadable directories are skipped
+			}
+			rules = append(rules[:len(rules):len(rules)], readGitignore(dir)...)
+			for _, entry := range entries {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				name := entry.Name()
+				if !showhidden && strings.HasPrefix(name, ".") || matchesAny(ignore, name) {
+					continue
+				}
+				path := filepath.Join(dir, name)
+				if ignored(rules, path, entry.IsDir()) {
+					continue
+				}
+				rel, _ := filepath.Rel(root, path)
+				batch = append(batch, rel)
+				if total++; total >= finderLimit {
+					return fmt.Errorf("stopped after %d files", finderLimit)
+				}
+				if time.Since(last) > 100*time.Millisecond {
+					flush()
+				}
+				// symlinks to directories are not followed
+				if entry.IsDir() {
+					if err := visit(path, rules); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		err := visit(root, parentGitignores(root))
+		flush()
+		ch <- finderDoneMsg{id, err}
+	}()
+	return listenCmd(ch)
+}
+
+func matchesAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func score(query string, paths []string) (results []fuzzyResult) {
+	runes := []rune(query)
+	for _, path := range paths {
+		if score, positions, ok := fuzzyMatch(runes, path); ok {
+			results = append(results, fuzzyResult{path, score, positions})
+		}
+	}
+	return results
+}
+
+// best first; shorter paths win ties
+func sortResults(results []fuzzyResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return len(a.path) < len(b.path)
+	})
+}
+
+// scoring all candidates can take a while, so it is done in background.
+// a longer query only matches paths that the shorter one matched, so only
+// the previous results are scored again when the query grows
+func (self *finder) rank() tea.Cmd {
+	query := self.input.String()
+	scored := len(self.candidates)
+	paths := self.candidates[:scored:scored]
+	if self.ranking == 0 && self.ranked != "" && strings.HasPrefix(query, self.ranked) {
+		paths = make([]string, len(self.results))
+		for i, result := range self.results {
+			paths[i] = result.path
+		}
+	}
+	id := nextJobId()
+	self.ranking = id
+	return func() tea.Msg {
+		results := score(query, paths)
+		sortResults(results)
+		return finderRankedMsg{id, query, results, scored}
+	}
+}
+
+func (self *finder) add(paths []string) {
+	self.candidates = append(self.candidates, paths...)
+	// the ranking in background scores them when it is done
+	if self.ranking != 0 {
+		return
+	}
+	self.results = append(self.results, score(self.ranked, paths)...)
+	if self.ranked != "" {
+		sortResults(self.results)
+	}
+}
+
+func (self *model) onFinderKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	finder := self.finder
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		self.closeFinder()
+
+	case "enter":
+		if len(finder.results) == 0 {
+			break
+		}
+		path := filepath.Join(finder.root, finder.results[finder.cursor].path)
+		self.closeFinder()
+		return self, refreshFilesFocus(filepath.Dir(path), filepath.Base(path))
+
+	case "up", "ctrl+p", "ctrl+k":
+		finder.cursor = max(finder.cursor-1, 0)
+
+	case "down", "ctrl+n", "ctrl+j":
+		finder.cursor = max(min(finder.cursor+1, len(finder.results)-1), 0)
+
+	default:
+		query := finder.input.String()
+		finder.input.onKey(msg)
+		if finder.input.String() != query {
+			return self, finder.rank()
+		}
+	}
+	return self, nil
+}
+
+func (self *model) onFinderRanked(msg finderRankedMsg) (tea.Model, tea.Cmd) {
+	finder := self.finder
+	if finder == nil || finder.ranking != msg.id {
+		return self, nil
+	}
+	finder.ranking = 0
+	finder.ranked = msg.query
+	finder.results = append(msg.results, score(msg.query, finder.candidates[msg.scored:])...)
+	if len(finder.candidates) > msg.scored {
+		sortResults(finder.results)
+	}
+	finder.cursor = 0
+	return self, nil
+}
+
+func (self *model) onFinderFound(msg finderFoundMsg) (tea.Model, tea.Cmd) {
+	if self.finder != nil && self.finder.id == msg.id {
+		self.finder.add(msg.paths)
+	}
+	// listen until the walk is done, even if the finder was closed
+	return self, listenCmd(msg.ch)
+}
+
+func (self *model) onFinderDone(msg finderDoneMsg) (tea.Model, tea.Cmd) {
+	if self.finder == nil || self.finder.id != msg.id {
+		return self, nil
+	}
+	self.finder.walking = false
+	if msg.err != nil && msg.err != context.Canceled {
+		self.status = newStatus(msg.err.Error(), true)
+		return self, clearStatusCmd(self.status.id)
+	}
+	return self, nil
+}
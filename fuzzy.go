@@ -0,0 +1,107 @@
+package main
+
+import (
+	"unicode"
+)
+
+// fzf-like scoring of a fuzzy match of query in text
+
+const (
+	scoreMatch       = 16
+	scoreGapStart    = -3
+	scoreGapExtend   = -1
+	bonusBoundary    = 8  // after a separator or at the start
+	bonusSlash       = 10 // at the start of a path component
+	bonusCamel       = 7  // upper case after lower case
+	bonusConsecutive = 8
+	bonusBasename    = 4 // in the last path component
+)
+
+func isSeparator(r rune) bool {
+	switch r {
+	case '/', '_', '-', '.', ' ':
+		return true
+	}
+	return false
+}
+
+// returns the score and indices of matched runes of text, or ok=false if query does not match.
+// matching is smart case: case sensitive only if query has upper case letters
+func fuzzyMatch(query []rune, text string) (score int, positions []int, ok bool) {
+	if len(query) == 0 {
+		return 0, nil, true
+	}
+	original := []rune(text)
+	runes := original
+	if !caseSensitive(string(query)) {
+		runes = make([]rune, len(original))
+		for i, r := range original {
+			runes[i] = unicode.ToLower(r)
+		}
+	}
+
+	// the first window that contains the query...
+	qi, end := 0, -1
+	for i, r := range runes {
+		if r == query[qi] {
+			qi++
+			if qi == len(query) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+	// ...shortened from the left by matching backwards
+	qi, start := len(query)-1, end
+	for i := end; i >= 0; i-- {
+		if runes[i] == query[qi] {
+			qi--
+			if qi < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	basename := 0
+	for i, r := range original {
+		if r == '/' {
+			basename = i + 1
+		}
+	}
+
+	positions = make([]int, 0, len(query))
+	qi = 0
+	prev := -1
+	for i := start; i <= end && qi < len(query); i++ {
+		if runes[i] != query[qi] {
+			continue
+		}
+		score += scoreMatch
+		switch {
+		case i == 0 || original[i-1] == '/':
+			score += bonusSlash
+		case isSeparator(original[i-1]):
+			score += bonusBoundary
+		case unicode.IsLower(original[i-1]) && unicode.IsUpper(original[i]):
+			score += bonusCamel
+		}
+		if i >= basename {
+			score += bonusBasename
+		}
+		if prev >= 0 {
+			if gap := i - prev - 1; gap == 0 {
+				score += bonusConsecutive
+			} else {
+				score += scoreGapStart + scoreGapExtend*(gap-1)
+			}
+		}
+		positions = append(positions, i)
+		prev = i
+		qi++
+	}
+	return score, positions, true
+}
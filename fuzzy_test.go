@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query     string
+		text      string
+		ok        bool
+		positions []int
+	}{
+		{"", "anything", true, nil},
+		{"fb", "foo/bar", true, []int{0, 4}},
+		{"abc", "aaxbc", true, []int{1, 3, 4}}, // the first window, shortened from the left
+		{"main", "cmd/main.go", true, []int{4, 5, 6, 7}},
+		{"cba", "abc", false, nil},
+		{"b", "FooBar", true, []int{3}},
+		{"B", "foobar", false, nil},
+		{"Fb", "FooBar", false, nil},
+		{"FB", "FooBar", true, []int{0, 3}},
+		{"é", "café", true, []int{3}},
+	}
+	for _, test := range tests {
+		_, positions, ok := fuzzyMatch([]rune(test.query), test.text)
+		if ok != test.ok || !reflect.DeepEqual(positions, test.positions) {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, %v, want %v, %v", test.query, test.text, positions, ok, test.positions, test.ok)
+		}
+	}
+}
+
+// the first text of each case scores higher than the second
+func TestFuzzyScoreOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		better, worse string
+	}{
+		{"consecutive", "abc", "abc.go", "a_b_c.go"},
+		{"start of component", "bar", "foo/bar", "foobar"},
+		{"after separator", "b", "foo_bar", "foobar"},
+		{"camel case", "b", "fooBar", "foobar"},
+		{"basename", "main", "src/main.go", "main/src.go"},
+		{"short gap", "ac", "abc", "abbbbc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			better, _, ok1 := fuzzyMatch([]rune(test.query), test.better)
+			worse, _, ok2 := fuzzyMatch([]rune(test.query), test.worse)
+			if !ok1 || !ok2 || better <= worse {
+				t.Errorf("%q scores %v, %q scores %v", test.better, better, test.worse, worse)
+			}
+		})
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	results := score("doc", []string{"a/b/doc", "docs", "src/d_o_c.go", "doc", "xyz"})
+	sortResults(results)
+	var got []string
+	for _, result := range results {
+		got = append(got, result.path)
+	}
+	want := []string{"doc", "docs", "a/b/doc", "src/d_o_c.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// text longer than this is previewed without colors; lexers are slow on long lines
+const highlightBytes = 32 * 1024
+
+// lines that are searched for modelines, at the beginning and at the end
+const modelineLines = 5
+
+var (
+	vimModeline   = regexp.MustCompile(`(?:^|\s)(?:vim?|ex):.*?\b(?:ft|filetype|syntax|syn)=([\w+-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-\s*(.*?)\s*-\*-`)
+	emacsMode     = regexp.MustCompile(`(?:^|;)\s*mode:\s*([\w+-]+)`)
+)
+
+// interpreters that are not named like the language
+var interpreters = map[string]string{
+	"node": "javascript",
+	"deno": "typescript",
+	"pwsh": "powershell",
+}
+
+// the language from a modeline, then the file name, then the shebang. nil if it is unknown
+func detectLexer(path string, lines []string) chroma.Lexer {
+	if name := modeline(lines); name != "" {
+		if lexer := lexers.Get(name); lexer != nil {
+			return lexer
+		}
+	}
+	if lexer := lexers.Match(filepath.Base(path)); lexer != nil {
+		return lexer
+	}
+	if len(lines) > 0 {
+		if name := shebang(lines[0]); name != "" {
+			if lexer := lexers.Get(name); lexer != nil {
+				return lexer
+			}
+			// python3.11 and such
+			if lexer := lexers.Get(strings.TrimRight(name, "0123456789.")); lexer != nil {
+				return lexer
+			}
+		}
+	}
+	return nil
+}
+
+// the file type from vim's "vim: set ft=python:" or emacs' "-*- mode: python -*-"
+func modeline(lines []string) string {
+	candidates := lines[:min(modelineLines, len(lines))]
+	if len(lines) > modelineLines {
+		candidates = append(candidates[:len(candidates):len(candidates)], lines[max(modelineLines, len(lines)-modelineLines):]...)
+	}
+	for _, line := range candidates {
+		if m := vimModeline.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+	}
+	// emacs only looks at the first line, or the second after a shebang
+	for _, line := range lines[:min(2, len(lines))] {
+		m := emacsModeline.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if mode := emacsMode.FindStringSubmatch(m[1]); mode != nil {
+			return mode[1]
+		}
+		if !strings.Contains(m[1], ":") {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// the interpreter of "#!/usr/bin/python3" or "#!/usr/bin/env -S python3 -u"
+func shebang(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	name := filepath.Base(fields[0])
+	if name == "env" {
+		name = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				name = filepath.Base(field)
+				break
+			}
+		}
+	}
+	if language, ok := interpreters[name]; ok {
+		return language
+	}
+	return name
+}
+
+// a formatter for the colors of the terminal, nil if it has none
+func terminalFormatter() chroma.Formatter {
+	switch lipgloss.ColorProfile() {
+	case termenv.TrueColor:
+		return formatters.TTY16m
+	case termenv.ANSI256:
+		return formatters.TTY256
+	case termenv.ANSI:
+		return formatters.TTY16
+	default:
+		return nil
+	}
+}
+
+// colorize lines of the file with the chroma style. lines are returned as they are if it is not possible
+func highlight(path string, lines []string, style string) []string {
+	if style == "none" {
+		return lines
+	}
+	text := strings.Join(lines, "\n")
+	if len(text) > highlightBytes {
+		return lines
+	}
+	formatter := terminalFormatter()
+	lexer := detectLexer(path, lines)
+	if formatter == nil || lexer == nil {
+		return lines
+	}
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, text)
+	if err != nil {
+		return lines
+	}
+
+	var highlighted []string
+	for _, line := range chroma.SplitTokensIntoLines(tokens.Tokens()) {
+		for i := range line {
+			line[i].Value = strings.TrimSuffix(line[i].Value, "\n")
+		}
+		var b strings.Builder
+		if err := formatter.Format(&b, styles.Get(style), chroma.Literator(line...)); err != nil {
+			return lines
+		}
+		highlighted = append(highlighted, b.String())
+	}
+	// lexers can add or drop a final empty line
+	if len(highlighted) > len(lines) {
+		highlighted = highlighted[:len(lines)]
+	}
+	return highlighted
+}
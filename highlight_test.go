@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"#!/bin/sh", "sh"},
+		{"#!/bin/bash -e", "bash"},
+		{"#! /usr/bin/python3", "python3"},
+		{"#!/usr/bin/env python3", "python3"},
+		{"#!/usr/bin/env -S python3 -u", "python3"},
+		{"#!/usr/bin/env LANG=C perl", "perl"},
+		{"#!/usr/bin/env node", "javascript"},
+		{"#!/usr/bin/env", ""},
+		{"#!", ""},
+		{"# !/bin/sh", ""},
+		{"print(1)", ""},
+	}
+	for _, test := range tests {
+		if got := shebang(test.line); got != test.want {
+			t.Errorf("shebang(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestModeline(t *testing.T) {
+	filler := strings.Split(strings.Repeat("x\n", 9), "\n")[:9]
+	lines := func(parts ...[]string) []string {
+		var result []string
+		for _, part := range parts {
+			result = append(result, part...)
+		}
+		return result
+	}
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"none", []string{"a", "b"}, ""},
+		{"empty", nil, ""},
+		{"vim set", []string{"# vim: set ft=python ts=4:"}, "python"},
+		{"vim filetype", []string{"// vim: filetype=go"}, "go"},
+		{"vi syntax", []string{"/* vi: syntax=c */"}, "c"},
+		{"ex", []string{"ex: ft=make"}, "make"},
+		{"vim not a word", []string{"novim: ft=python"}, ""},
+		{"vim at the end", lines(filler, []string{"# vim: ft=ruby"}), "ruby"},
+		{"vim in the middle", lines(filler[:5], []string{"# vim: ft=ruby"}, filler), ""},
+		{"emacs mode", []string{"# -*- mode: perl; coding: utf-8 -*-"}, "perl"},
+		{"emacs short", []string{";; -*- lisp -*-"}, "lisp"},
+		{"emacs after shebang", []string{"#!/bin/sh", "# -*- mode: bash -*-"}, "bash"},
+		{"emacs third line", []string{"a", "b", "# -*- mode: bash -*-"}, ""},
+		{"emacs without mode", []string{"# -*- coding: utf-8 -*-"}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := modeline(test.lines); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
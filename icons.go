@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// glyphs shown before file names, looked up by exact name, then extension, then file type
+
+type iconSet struct {
+	names map[string]string
+	exts  map[string]string // lower case, without the dot
+	types map[string]string
+}
+
+// keys of iconSet.types
+var iconTypes = set[string]{
+	"dir": {}, "file": {}, "link": {}, "linkdir": {}, "broken": {},
+	"exec": {}, "socket": {}, "pipe": {}, "device": {},
+}
+
+func newIconSet() iconSet {
+	return iconSet{make(map[string]string), make(map[string]string), make(map[string]string)}
+}
+
+// needs a Nerd Font
+func nerdIcons() iconSet {
+	return iconSet{
+		names: map[string]string{
+			"Makefile":       "",
+			"go.mod":         "",
+			"go.sum":         "",
+			"Dockerfile":     "",
+			".gitignore":     "",
+			".gitattributes": "",
+			".gitmodules":    "",
+			".git":           "",
+			"LICENSE":        "",
+			"README.md":      "",
+			"README":         "",
+		},
+		exts: map[string]string{
+			"go":    "",
+			"py":    "",
+			"js":    "",
+			"ts":    "",
+			"rs":    "",
+			"c":     "",
+			"cpp":   "",
+			"h":     "",
+			"java":  "",
+			"rb":    "",
+			"lua":   "",
+			"sh":    "",
+			"bash":  "",
+			"zsh":   "",
+			"fish":  "",
+			"vim":   "",
+			"html":  "",
+			"css":   "",
+			"md":    "",
+			"json":  "",
+			"yml":   "",
+			"yaml":  "",
+			"toml":  "",
+			"ini":   "",
+			"conf":  "",
+			"txt":   "",
+			"pdf":   "",
+			"diff":  "",
+			"patch": "",
+			"lock":  "",
+			"zip":   "",
+			"tar":   "",
+			"gz":    "",
+			"xz":    "",
+			"zst":   "",
+			"bz2":   "",
+			"7z":    "",
+			"rar":   "",
+			"png":   "",
+			"jpg":   "",
+			"jpeg":  "",
+			"gif":   "",
+			"webp":  "",
+			"svg":   "",
+			"bmp":   "",
+			"mp3":   "",
+			"flac":  "",
+			"wav":   "",
+			"ogg":   "",
+			"mp4":   "",
+			"mkv":   "",
+			"webm":  "",
+			"avi":   "",
+			"mov":   "",
+		},
+		types: map[string]string{
+			"dir":     "",
+			"file":    "",
+			"link":    "",
+			"linkdir": "",
+			"broken":  "",
+			"exec":    "",
+			"socket":  "",
+			"pipe":    "",
+			"device":  "",
+		},
+	}
+}
+
+// like ls -F
+func asciiIcons() iconSet {
+	return iconSet{
+		names: map[string]string{},
+		exts:  map[string]string{},
+		types: map[string]string{
+			"dir":     "/",
+			"file":    "-",
+			"link":    "@",
+			"linkdir": "@",
+			"broken":  "!",
+			"exec":    "*",
+			"socket":  "=",
+			"pipe":    "|",
+			"device":  "#",
+		},
+	}
+}
+
+func iconSetByName(name string) (iconSet, bool) {
+	switch name {
+	case "nerd":
+		return nerdIcons(), true
+	case "ascii":
+		return asciiIcons(), true
+	}
+	return iconSet{}, false
+}
+
+// set an icon from "icon name|ext|type <key> <glyph>" arguments
+func (self iconSet) set(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("expected name|ext|type <key> <glyph>")
+	}
+	kind, key, glyph := args[0], args[1], args[2]
+	switch kind {
+	case "name":
+		self.names[key] = glyph
+	case "ext":
+		self.exts[strings.ToLower(strings.TrimPrefix(key, "."))] = glyph
+	case "type":
+		if !iconTypes.Contains(key) {
+			return fmt.Errorf("unknown file type %v", key)
+		}
+		self.types[key] = glyph
+	default:
+		return fmt.Errorf("expected name, ext or type, got %v", kind)
+	}
+	return nil
+}
+
+func fileType(file File) string {
+	switch {
+	case file.Broken:
+		return "broken"
+	case file.IsLink && file.IsDir:
+		return "linkdir"
+	case file.IsLink:
+		return "link"
+	case file.IsDir:
+		return "dir"
+	}
+	switch typ := lsType(file.Mode); typ {
+	case "so":
+		return "socket"
+	case "pi":
+		return "pipe"
+	case "bd", "cd":
+		return "device"
+	case "ex", "su", "sg":
+		return "exec"
+	}
+	return "file"
+}
+
+// sets are tried in order, so that overrides can go first
+func lookupIcon(file File, sets ...iconSet) string {
+	typ := fileType(file)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file.Name), "."))
+	// links are shown by type so that they stand out
+	if typ != "link" && typ != "linkdir" && typ != "broken" {
+		for _, set := range sets {
+			if icon, ok := set.names[file.Name]; ok {
+				return icon
+			}
+		}
+		if typ != "dir" && ext != "" {
+			for _, set := range sets {
+				if icon, ok := set.exts[ext]; ok {
+					return icon
+				}
+			}
+		}
+	}
+	for _, set := range sets {
+		if icon, ok := set.types[typ]; ok {
+			return icon
+		}
+	}
+	for _, set := range sets {
+		if icon, ok := set.types["file"]; ok {
+			return icon
+		}
+	}
+	return " "
+}
+
+// the icon of the file; false if icons are disabled
+func (self *config) icon(file File) (string, bool) {
+	if self.icons == nil {
+		return "", false
+	}
+	return lookupIcon(file, self.iconsOwn, *self.icons), true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitignoreRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		nomatch []string
+	}{
+		{"*.o", []string{"a.o", "dir/a.o", ".o"}, []string{"a.oo", "a.o/b"}},
+		{"build", []string{"build", "a/build"}, []string{"builds", "build/x"}},
+		{"/build", []string{"build"}, []string{"a/build"}},
+		{"doc/*.txt", []string{"doc/a.txt"}, []string{"a/doc/a.txt", "doc/sub/a.txt"}},
+		{"**/logs", []string{"logs", "a/b/logs"}, []string{"logs/x"}},
+		{"a/**/b", []string{"a/b", "a/x/b", "a/x/y/b"}, []string{"ab", "x/a/b"}},
+		{"a/**", []string{"a/x", "a/x/y"}, []string{"a", "b/a/x"}},
+		{"?.c", []string{"a.c"}, []string{"ab.c", "/.c"}},
+		{"[ab].c", []string{"a.c", "b.c"}, []string{"c.c"}},
+		{"[!ab].c", []string{"c.c"}, []string{"a.c"}},
+		{"[a", []string{"[a"}, []string{"a"}},
+		{`\*.c`, []string{"*.c"}, []string{"a.c"}},
+		{"a+b(c)", []string{"a+b(c)"}, []string{"aab(c)"}},
+	}
+	for _, test := range tests {
+		re, err := gitignoreRegexp(test.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", test.pattern, err)
+			continue
+		}
+		for _, path := range test.match {
+			if !re.MatchString(path) {
+				t.Errorf("%q does not match %q", test.pattern, path)
+			}
+		}
+		for _, path := range test.nomatch {
+			if re.MatchString(path) {
+				t.Errorf("%q matches %q", test.pattern, path)
+			}
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".gitignore":     "# comment\n*.log\n!keep.log\nbuild/\n\\#hash\n",
+		"sub/.gitignore": "/local\n",
+	})
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	rules := append(parentGitignores(filepath.Join(dir, "sub")), readGitignore(filepath.Join(dir, "sub"))...)
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"sub/a.log", false, true},
+		{"sub/keep.log", false, false},
+		{"sub/build", true, true},
+		{"sub/build", false, false},
+		{"sub/#hash", false, true},
+		{"sub/local", false, true},
+		{"sub/x/local", false, false},
+		{"sub/a.txt", false, false},
+	}
+	for _, test := range tests {
+		if got := ignored(rules, filepath.Join(dir, test.path), test.isDir); got != test.want {
+			t.Errorf("ignored(%q, dir %v) = %v, want %v", test.path, test.isDir, got, test.want)
+		}
+	}
+	if rules := parentGitignores(t.TempDir()); rules != nil {
+		t.Errorf("rules outside of a repository: %v", rules)
+	}
+}
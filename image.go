@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/sys/unix"
+)
+
+type ImageProtocol byte
+
+const (
+	ImageAuto ImageProtocol = iota
+	ImageNone
+	ImageHalfblocks
+	ImageKitty
+	ImageSixel
+	ImageITerm
+)
+
+var imageProtocols = []string{"auto", "none", "halfblocks", "kitty", "sixel", "iterm"}
+
+func (self ImageProtocol) String() string {
+	return imageProtocols[self]
+}
+
+func parseImageProtocol(s string) (ImageProtocol, bool) {
+	for i, name := range imageProtocols {
+		if name == s {
+			return ImageProtocol(i), true
+		}
+	}
+	return 0, false
+}
+
+// images larger than this are not decoded
+const imagePixels = 50_000_000
+
+// one id is enough, there is one image at a time
+const kittyImageID = 1
+
+// pick the protocol from the environment of the terminal. the protocols do not pass through tmux
+func detectImageProtocol() ImageProtocol {
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("TMUX") != "" || strings.HasPrefix(term, "screen"):
+		return ImageHalfblocks
+	case term == "xterm-kitty" || os.Getenv("KITTY_WINDOW_ID") != "" || program == "ghostty":
+		return ImageKitty
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return ImageITerm
+	case strings.Contains(term, "foot") || strings.Contains(term, "mlterm") || strings.Contains(term, "sixel") ||
+		strings.Contains(term, "contour") || program == "mintty":
+		return ImageSixel
+	default:
+		return ImageHalfblocks
+	}
+}
+
+// an image that is written over the blank lines of the preview
+type terminalImage struct {
+	protocol ImageProtocol
+	transmit string // sent once before the first placement; kitty keeps the image
+	place    string // draws the image at the cursor
+	rows     int
+
+	transmitted bool
+	shown       bool // it is drawn after every frame
+}
+
+// the output of the program. the renderer writes a frame at once, and rewrites the lines that
+// changed as a whole, which erases the cells of an image over them. the image is written right
+// after every write, under the same lock, so that it stays on top and is never mixed into a frame
+type screenWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	alt     bool   // the alternate screen is on; the image is only drawn there
+	pending string // written once, before the next write
+	overlay string // written after every write
+}
+
+var screen = &screenWriter{out: os.Stderr}
+
+var (
+	altScreenOn  = []byte(termenv.CSI + termenv.AltScreenSeq)
+	altScreenOff = []byte(termenv.CSI + termenv.ExitAltScreenSeq)
+)
+
+func (self *screenWriter) Write(p []byte) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.pending != "" {
+		if _, err := io.WriteString(self.out, self.pending); err != nil {
+			return 0, err
+		}
+		self.pending = ""
+	}
+	n, err := self.out.Write(p)
+	if err != nil {
+		return n, err
+	}
+	// the program leaves the alternate screen to run commands, and when it quits
+	if on, off := bytes.LastIndex(p, altScreenOn), bytes.LastIndex(p, altScreenOff); on != off {
+		self.alt = on > off
+	}
+	if self.alt && self.overlay != "" {
+		_, err = io.WriteString(self.out, self.overlay)
+	}
+	return n, err
+}
+
+// write setup before the next frame, and seq after every frame from then on
+func (self *screenWriter) draw(setup string, seq string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.pending += setup
+	self.overlay = seq
+}
+
+// stop drawing, and write seq before the next frame
+func (self *screenWriter) clear(seq string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.pending += seq
+	self.overlay = ""
+}
+
+// size of a cell in pixels, guessed if the terminal does not tell
+func cellSize() (width int, height int) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stderr.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Xpixel == 0 || ws.Ypixel == 0 || ws.Col == 0 || ws.Row == 0 {
+		return 8, 16
+	}
+	return int(ws.Xpixel) / int(ws.Col), int(ws.Ypixel) / int(ws.Row)
+}
+
+// decode the image and fit it into width x height cells. the first line tells the format and size;
+// with halfblocks, the image is in the lines, otherwise it has to be drawn over them
+func previewImage(path string, protocol ImageProtocol, width int, height int) ([]string, *terminalImage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := fmt.Sprintf("%v image, %dx%d", format, config.Width, config.Height)
+	if config.Width*config.Height > imagePixels {
+		return []string{info, "too large to preview"}, nil, nil
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, nil, err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := []string{info}
+	height--
+	if width <= 0 || height <= 0 {
+		return lines, nil, nil
+	}
+
+	if protocol == ImageHalfblocks {
+		// a cell is two pixels high, which makes them about square
+		return append(lines, halfblocks(scale(img, width, height*2))...), nil, nil
+	}
+
+	cellWidth, cellHeight := cellSize()
+	// sixel draws bands of 6 pixels; a taller image would scroll the screen
+	img = scale(img, width*cellWidth, height*cellHeight/6*6)
+	bounds := img.Bounds()
+	rows := (bounds.Dy() + cellHeight - 1) / cellHeight
+	for i := 0; i < rows; i++ {
+		lines = append(lines, " ")
+	}
+
+	var encoded bytes.Buffer
+	if protocol != ImageSixel {
+		if err := png.Encode(&encoded, img); err != nil {
+			return nil, nil, err
+		}
+	}
+	switch protocol {
+	case ImageKitty:
+		// placing it again with the same placement id moves the one placement
+		return lines, &terminalImage{
+			rows:     rows,
+			protocol: protocol,
+			transmit: kittyTransmit(encoded.Bytes()),
+			place:    fmt.Sprintf("\x1b_Ga=p,i=%d,p=1,q=2,C=1\x1b\\", kittyImageID),
+		}, nil
+	case ImageITerm:
+		place := fmt.Sprintf("\x1b]1337;File=inline=1;size=%d;width=%dpx;height=%dpx;preserveAspectRatio=1:%s\a",
+			encoded.Len(), bounds.Dx(), bounds.Dy(), base64.StdEncoding.EncodeToString(encoded.Bytes()))
+		return lines, &terminalImage{rows: rows, protocol: protocol, place: place}, nil
+	default:
+		return lines, &terminalImage{rows: rows, protocol: protocol, place: sixel(img)}, nil
+	}
+}
+
+// fit into width x height pixels, keeping the aspect ratio. images are not made larger
+func scale(img image.Image, width int, height int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > width {
+		w, h = width, h*width/w
+	}
+	if h > height {
+		w, h = w*height/h, height
+	}
+	w, h = max(w, 1), max(h, 1)
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// upper half block with the top pixel as foreground and the bottom one as background
+func halfblocks(img image.Image) []string {
+	profile := lipgloss.ColorProfile()
+	if profile == termenv.Ascii {
+		return nil
+	}
+	// transparent pixels are left to the background of the terminal
+	hex := func(c color.Color) (string, bool) {
+		r, g, b, a := c.RGBA()
+		if a < 0x8000 {
+			return "", false
+		}
+		return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8), true
+	}
+
+	bounds := img.Bounds()
+	var lines []string
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		var line strings.Builder
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			top, topOk := hex(img.At(x, y))
+			bottom, bottomOk := "", false
+			if y+1 < bounds.Max.Y {
+				bottom, bottomOk = hex(img.At(x, y+1))
+			}
+			switch {
+			case topOk && bottomOk:
+				fmt.Fprintf(&line, "\x1b[%s;%sm▀", profile.Color(top).Sequence(false), profile.Color(bottom).Sequence(true))
+			case topOk:
+				fmt.Fprintf(&line, "\x1b[%sm▀", profile.Color(top).Sequence(false))
+			case bottomOk:
+				fmt.Fprintf(&line, "\x1b[%sm▄", profile.Color(bottom).Sequence(false))
+			default:
+				line.WriteByte(' ')
+			}
+			line.WriteString("\x1b[0m")
+		}
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// png data in chunks of at most 4096 bytes of base64, as kitty wants it
+func kittyTransmit(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for i := 0; i < len(encoded); i += 4096 {
+		chunk := encoded[i:min(i+4096, len(encoded))]
+		more := 0
+		if i+4096 < len(encoded) {
+			more = 1
+		}
+		if i == 0 {
+			fmt.Fprintf(&b, "\x1b_Ga=t,f=100,i=%d,q=2,m=%d;%s\x1b\\", kittyImageID, more, chunk)
+		} else {
+			fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	return b.String()
+}
+
+// encode with a 256 color palette. every band of 6 rows is drawn once for each of its colors
+func sixel(img image.Image) string {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, bounds.Min)
+	width, height := paletted.Bounds().Dx(), paletted.Bounds().Dy()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range paletted.Palette {
+		r, g, bl, _ := c.RGBA()
+		fmt.Fprintf(&b, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, bl*100/0xffff)
+	}
+
+	sixels := make([]byte, width)
+	for top := 0; top < height; top += 6 {
+		var used [256]bool
+		for y := top; y < min(top+6, height); y++ {
+			for x := 0; x < width; x++ {
+				used[paletted.ColorIndexAt(x, y)] = true
+			}
+		}
+		first := true
+		for index := range used {
+			if !used[index] {
+				continue
+			}
+			for x := 0; x < width; x++ {
+				var bits byte
+				for dy := 0; dy < 6 && top+dy < height; dy++ {
+					if int(paletted.ColorIndexAt(x, top+dy)) == index {
+						bits |= 1 << dy
+					}
+				}
+				sixels[x] = '?' + bits
+			}
+			if !first {
+				b.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(&b, "#%d", index)
+			writeSixelRun(&b, sixels)
+		}
+		b.WriteByte('-')
+	}
+	b.WriteString("\x1b\\")
+	return b.String()
+}
+
+// run length encoded, like !12~ for 12 full columns
+func writeSixelRun(b *strings.Builder, sixels []byte) {
+	for i := 0; i < len(sixels); {
+		j := i
+		for j < len(sixels) && sixels[j] == sixels[i] {
+			j++
+		}
+		if n := j - i; n > 3 {
+			fmt.Fprintf(b, "!%d%c", n, sixels[i])
+		} else {
+			b.Write(sixels[i:j])
+		}
+		i = j
+	}
+}
+
+// where the image is drawn on the screen, counted from 1: below the first line of the preview
+func (self *model) imagePosition() (row int, col int) {
+	return 3, self.width/2 + 1
+}
+
+// from now on, write the image after every frame
+func (self *model) drawImage() {
+	img := self.image
+	row, col := self.imagePosition()
+	setup := ""
+	if !img.transmitted {
+		setup = img.transmit
+		img.transmitted = true
+	}
+	screen.draw(setup, fmt.Sprintf("\x1b7\x1b[%d;%dH%s\x1b8", row, col, img.place))
+	img.shown = true
+}
+
+// kitty draws images on their own layer, where they are deleted. with the others, the image
+// is in the cells, and erasing them to the end of the line before the next frame clears the
+// preview pane; the lines that the frame does not rewrite were blank under the image
+func (self *model) clearImage() {
+	img := self.image
+	img.shown = false
+	if img.protocol == ImageKitty {
+		screen.clear(fmt.Sprintf("\x1b_Ga=d,d=i,i=%d,q=2\x1b\\", kittyImageID))
+		return
+	}
+	row, col := self.imagePosition()
+	var seq strings.Builder
+	seq.WriteString("\x1b7")
+	for i := 0; i < img.rows; i++ {
+		fmt.Fprintf(&seq, "\x1b[%d;%dH\x1b[K", row+i, col)
+	}
+	seq.WriteString("\x1b8")
+	screen.clear(seq.String())
+}
+
+// after every update: draw the image if it is visible, or clear it if it is not
+func (self *model) syncImage() {
+	img := self.image
+	if img == nil {
+		return
+	}
+	visible := self.currentView == ViewFiles && self.config.preview && !self.empty
+	switch {
+	case visible && !img.shown:
+		self.drawImage()
+	case !visible && img.shown:
+		self.clearImage()
+	}
+}
+
+// a model or a pointer to it, as handlers return
+func withImage(next tea.Model, cmd tea.Cmd) (tea.Model, tea.Cmd) {
+	m, ok := next.(*model)
+	if !ok {
+		v := next.(model)
+		m = &v
+	}
+	m.syncImage()
+	return m, cmd
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScreenWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &screenWriter{out: &out}
+	write := func(s string) string {
+		out.Reset()
+		w.Write([]byte(s))
+		return out.String()
+	}
+
+	w.draw("<setup>", "<image>")
+	if got := write("frame"); got != "<setup>frame" {
+		t.Errorf("before the alternate screen: %q", got)
+	}
+	if got := write(string(altScreenOn)); got != string(altScreenOn)+"<image>" {
+		t.Errorf("entering the alternate screen: %q", got)
+	}
+	if got := write("frame"); got != "frame<image>" {
+		t.Errorf("after a frame: %q", got)
+	}
+	if got := write(string(altScreenOff)); got != string(altScreenOff) {
+		t.Errorf("leaving the alternate screen: %q", got)
+	}
+	if got := write(string(altScreenOff) + "x" + string(altScreenOn)); got != string(altScreenOff)+"x"+string(altScreenOn)+"<image>" {
+		t.Errorf("leaving and entering: %q", got)
+	}
+
+	w.clear("<clear>")
+	if got := write("frame"); got != "<clear>frame" {
+		t.Errorf("after clear: %q", got)
+	}
+	if got := write("frame"); got != "frame" {
+		t.Errorf("after the cleared frame: %q", got)
+	}
+}
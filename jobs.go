@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type JobState byte
+
+const (
+	JobRunning JobState = iota
+	JobDone
+	JobFailed
+	JobCancelled
+)
+
+func (self JobState) String() string {
+	switch self {
+	case JobRunning:
+		return "running"
+	case JobDone:
+		return "done"
+	case JobFailed:
+		return "failed"
+	case JobCancelled:
+		return "cancelled"
+	default:
+		panic("unknown JobState")
+	}
+}
+
+// a file operation running in background
+type job struct {
+	id      int
+	name    string
+	state   JobState
+	err     error
+	started time.Time
+	cancel  context.CancelFunc
+	// last progress report
+	progress progressMsg
+}
+
+var lastJobId atomic.Int64
+
+func nextJobId() int {
+	return int(lastJobId.Add(1))
+}
+
+type jobStartedMsg struct {
+	id     int
+	name   string
+	cancel context.CancelFunc
+	ch     <-chan tea.Msg
+}
+
+// msg is the result of the operation
+type jobDoneMsg struct {
+	id  int
+	err error
+	msg tea.Msg
+}
+
+func (self *model) job(id int) *job {
+	for _, job := range self.jobs {
+		if job.id == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (self *model) runningJobs() (n int) {
+	for _, job := range self.jobs {
+		if job.state == JobRunning {
+			n++
+		}
+	}
+	return
+}
+
+func (self *model) onJobStarted(msg jobStartedMsg) {
+	self.jobs = append(self.jobs, &job{
+		id:       msg.id,
+		name:     msg.name,
+		state:    JobRunning,
+		started:  time.Now(),
+		cancel:   msg.cancel,
+		progress: progressMsg{op: msg.name},
+	})
+	self.jobsCursor = max(min(self.jobsCursor, len(self.jobs)-1), 0)
+}
+
+func (self *model) onJobDone(msg jobDoneMsg) {
+	job := self.job(msg.id)
+	if job == nil {
+		return
+	}
+	job.err = msg.err
+	switch {
+	case errors.Is(msg.err, context.Canceled):
+		job.state = JobCancelled
+	case msg.err != nil:
+		job.state = JobFailed
+	default:
+		job.state = JobDone
+	}
+}
+
+// forget finished jobs
+func (self *model) clearJobs() {
+	self.jobs = filter(&self.jobs, func(job *job) bool {
+		return job.state == JobRunning
+	})
+	self.jobsCursor = max(min(self.jobsCursor, len(self.jobs)-1), 0)
+}
+
+// keys of the jobs view
+func (self *model) onJobsKey(key string) (tea.Model, tea.Cmd) {
+	switch key {
+	case "j", "down":
+		self.jobsCursor = max(min(self.jobsCursor+1, len(self.jobs)-1), 0)
+	case "k", "up":
+		self.jobsCursor = max(self.jobsCursor-1, 0)
+	case "g", "home":
+		self.jobsCursor = 0
+	case "G", "end":
+		self.jobsCursor = max(len(self.jobs)-1, 0)
+	case "x":
+		if len(self.jobs) > 0 && self.jobs[self.jobsCursor].state == JobRunning {
+			self.jobs[self.jobsCursor].cancel()
+			self.status = newStatus(fmt.Sprintf("cancelling job %d", self.jobs[self.jobsCursor].id), false)
+			return self, clearStatusCmd(self.status.id)
+		}
+	case "C":
+		self.clearJobs()
+	case "q", "esc", "J":
+		self.currentView = ViewFiles
+	}
+	return self, nil
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// reversible records of file operations, for undo and redo
+
+const (
+	JournalRename = "rename"
+	JournalCreate = "create"
+	JournalTrash  = "trash"
+)
+
+const journalSize = 100
+
+// a renamed file, with the modification and size of its tree after the rename
+type journalRename struct {
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Modified time.Time `json:"modified"`
+	Size     int64     `json:"size"`
+}
+
+// the renamed file at path, as it should be there
+func (self journalRename) file(path string) journalFile {
+	return journalFile{path, self.Modified, self.Size}
+}
+
+// a created file, as it was right after creation.
+// for directories, the latest modification and the total size of the tree
+type journalFile struct {
+	Path     string    `json:"path"`
+	Modified time.Time `json:"modified"`
+	Size     int64     `json:"size"`
+}
+
+// a file must be as it was recorded, so that undo and redo do not lose later changes to it
+func (self journalFile) check(what string) error {
+	now, err := statTree(self.Path)
+	if err != nil {
+		return fmt.Errorf("%v no longer exists", withTilde(self.Path))
+	}
+	if !now.Modified.Equal(self.Modified) || now.Size != self.Size {
+		return fmt.Errorf("%v was modified after it was %s", withTilde(self.Path), what)
+	}
+	return nil
+}
+
+func statTree(path string) (file journalFile, err error) {
+	file.Path = path
+	err = filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(file.Modified) {
+			file.Modified = info.ModTime()
+		}
+		if !info.IsDir() {
+			file.Size += info.Size()
+		}
+		return nil
+	})
+	return
+}
+
+type journalEntry struct {
+	Kind    string          `json:"kind"`
+	Time    time.Time       `json:"time"`
+	Renames []journalRename `json:"renames,omitempty"`
+	Created []journalFile   `json:"created,omitempty"`
+	// trashed files; for created files, where undo has put them
+	Trashed []trashItem `json:"trashed,omitempty"`
+	// destinations that were overwritten, in the trash until undo restores them
+	Replaced []trashItem `json:"replaced,omitempty"`
+}
+
+type journal struct {
+	Undo []journalEntry `json:"undo"`
+	Redo []journalEntry `json:"redo"`
+}
+
+type journalLoadedMsg struct {
+	journal journal
+	err     error
+}
+
+type journalSavedMsg struct {
+	err error
+}
+
+// result of undo or redo of the last entry
+type journalMsg struct {
+	entry journalEntry
+	undo  bool
+	err   error
+}
+
+func journalPath() string {
+	return filepath.Join(envOr("XDG_STATE_HOME", expandHome("~/.local/state")), "bubblefm", "journal.json")
+}
+
+// stat the renamed files, so that undo can tell if they were changed later
+func renameEntry(pairs []renamePair) journalEntry {
+	entry := journalEntry{Kind: JournalRename, Time: time.Now()}
+	for _, pair := range pairs {
+		file, _ := statTree(pair.to)
+		entry.Renames = append(entry.Renames, journalRename{pair.from, pair.to, file.Modified, file.Size})
+	}
+	return entry
+}
+
+func trashEntry(items []trashItem) journalEntry {
+	return journalEntry{Kind: JournalTrash, Time: time.Now(), Trashed: items}
+}
+
+// stat the created files, so that undo can tell if they were changed later
+func createEntry(paths []string, replaced []trashItem) journalEntry {
+	entry := journalEntry{Kind: JournalCreate, Time: time.Now(), Replaced: replaced}
+	for _, path := range paths {
+		file, err := statTree(path)
+		if err != nil {
+			continue
+		}
+		entry.Created = append(entry.Created, file)
+	}
+	return entry
+}
+
+func (self journalEntry) String() string {
+	switch self.Kind {
+	case JournalRename:
+		return fmt.Sprintf("rename of %d files", len(self.Renames))
+	case JournalCreate:
+		return fmt.Sprintf("creation of %d files", len(self.Created))
+	case JournalTrash:
+		return fmt.Sprintf("trashing of %d files", len(self.Trashed))
+	default:
+		return self.Kind
+	}
+}
+
+// add the entry, which makes the redo history obsolete. returns false if there was nothing to record
+func (self *journal) record(entry journalEntry) bool {
+	if len(entry.Renames)+len(entry.Created)+len(entry.Trashed)+len(entry.Replaced) == 0 {
+		return false
+	}
+	self.Undo = append(self.Undo, entry)
+	if len(self.Undo) > journalSize {
+		self.Undo = self.Undo[len(self.Undo)-journalSize:]
+	}
+	self.Redo = nil
+	return true
+}
+
+func loadJournalCmd() tea.Cmd {
+	return func() tea.Msg {
+		var msg journalLoadedMsg
+		content, err := os.ReadFile(journalPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return msg
+		}
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		msg.err = json.Unmarshal(content, &msg.journal)
+		return msg
+	}
+}
+
+func saveJournalCmd(journal journal) tea.Cmd {
+	content, err := json.Marshal(journal)
+	return func() tea.Msg {
+		if err != nil {
+			return journalSavedMsg{err}
+		}
+		path := journalPath()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return journalSavedMsg{err}
+		}
+		// through a temporary file, so that a crash does not leave half of the journal
+		tmp, err := os.CreateTemp(filepath.Dir(path), "journal-*.json")
+		if err != nil {
+			return journalSavedMsg{err}
+		}
+		_, err = tmp.Write(content)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+		return journalSavedMsg{err}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// the error, and the error of going back if that failed too
+func rollback(err error, back func() error) error {
+	if backErr := back(); backErr != nil {
+		return fmt.Errorf("%w; could not go back: %v", err, backErr)
+	}
+	return err
+}
+
+func reversed(renames []journalRename) []journalRename {
+	var result []journalRename
+	for i := len(renames) - 1; i >= 0; i-- {
+		rename := renames[i]
+		rename.From, rename.To = rename.To, rename.From
+		result = append(result, rename)
+	}
+	return result
+}
+
+// check that the renames can run one after another in the current filesystem
+func checkRenames(renames []journalRename) error {
+	// paths that the earlier renames will have created or removed
+	simulated := make(map[string]bool)
+	existsAfter := func(path string) bool {
+		if e, ok := simulated[path]; ok {
+			return e
+		}
+		return exists(path)
+	}
+	for _, rename := range renames {
+		if !existsAfter(rename.From) {
+			return fmt.Errorf("%v no longer exists", withTilde(rename.From))
+		}
+		if existsAfter(rename.To) {
+			return fmt.Errorf("%v exists", withTilde(rename.To))
+		}
+		simulated[rename.From] = false
+		simulated[rename.To] = true
+	}
+	return nil
+}
+
+// run all renames or none: the done ones are renamed back when one fails
+func runJournalRenames(renames []journalRename) error {
+	for _, rename := range renames {
+		if err := rename.file(rename.From).check("renamed"); err != nil {
+			return err
+		}
+	}
+	if err := checkRenames(renames); err != nil {
+		return err
+	}
+	// moves could have been across devices
+	op := newFileop("moving")
+	defer op.cancel()
+	op.policy = ConflictSkip
+	for i, rename := range renames {
+		if err := op.movePath(rename.From, rename.To); err != nil {
+			return rollback(err, func() error {
+				var errs []error
+				for _, rename := range reversed(renames[:i]) {
+					errs = append(errs, op.movePath(rename.From, rename.To))
+				}
+				return errors.Join(errs...)
+			})
+		}
+	}
+	return nil
+}
+
+// restore all items or none: the restored ones go back to the trash when one fails
+func restoreTrashed(items []trashItem) error {
+	if err := checkTrashed(items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if exists(item.Original) {
+			return fmt.Errorf("%v exists", withTilde(item.Original))
+		}
+	}
+	for i, item := range items {
+		if err := item.restore(); err != nil {
+			return rollback(err, func() error { return putBack(items[:i]) })
+		}
+	}
+	return nil
+}
+
+func checkTrashed(items []trashItem) error {
+	for _, item := range items {
+		if !exists(item.filesPath()) {
+			return fmt.Errorf("%v is no longer in trash", withTilde(item.Original))
+		}
+	}
+	return nil
+}
+
+func putBack(items []trashItem) error {
+	var errs []error
+	for _, item := range items {
+		errs = append(errs, item.putBack())
+	}
+	return errors.Join(errs...)
+}
+
+// trash all paths or none: the trashed ones are restored when one fails
+func trashOriginals(paths []string) (items []trashItem, err error) {
+	for _, path := range paths {
+		if !exists(path) {
+			return nil, fmt.Errorf("%v no longer exists", withTilde(path))
+		}
+	}
+	for _, path := range paths {
+		item, err := trashPath(path)
+		if err != nil {
+			return nil, rollback(err, func() error { return restoreAll(items) })
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// unlike restoreTrashed, restores as many as it can
+func restoreAll(items []trashItem) error {
+	var errs []error
+	for _, item := range items {
+		errs = append(errs, item.restore())
+	}
+	return errors.Join(errs...)
+}
+
+// trash the overwritten files again, before redo overwrites them
+func (self *journalEntry) trashReplaced() error {
+	var paths []string
+	for _, item := range self.Replaced {
+		paths = append(paths, item.Original)
+	}
+	items, err := trashOriginals(paths)
+	if err != nil {
+		return err
+	}
+	self.Replaced = items
+	return nil
+}
+
+// undo and redo change all files of the entry or none. when they fail, what was
+// done is undone, and the entry is returned as it was
+func undoEntry(entry journalEntry) (journalEntry, error) {
+	switch entry.Kind {
+	case JournalRename:
+		if err := runJournalRenames(reversed(entry.Renames)); err != nil {
+			return entry, err
+		}
+		if err := restoreTrashed(entry.Replaced); err != nil {
+			return entry, rollback(err, func() error { return runJournalRenames(entry.Renames) })
+		}
+		return entry, nil
+
+	case JournalCreate:
+		// created files are trashed rather than deleted, so that redo can bring them back
+		var paths []string
+		for _, file := range entry.Created {
+			if err := file.check("created"); err != nil {
+				return entry, err
+			}
+			paths = append(paths, file.Path)
+		}
+		// before a created file can take the name of a missing one in the trash
+		if err := checkTrashed(entry.Replaced); err != nil {
+			return entry, err
+		}
+		items, err := trashOriginals(paths)
+		if err != nil {
+			return entry, err
+		}
+		if err := restoreTrashed(entry.Replaced); err != nil {
+			return entry, rollback(err, func() error { return restoreAll(items) })
+		}
+		undone := entry
+		undone.Trashed = items
+		return undone, nil
+
+	case JournalTrash:
+		return entry, restoreTrashed(entry.Trashed)
+
+	default:
+		return entry, fmt.Errorf("unknown journal entry %v", entry.Kind)
+	}
+}
+
+func redoEntry(entry journalEntry) (journalEntry, error) {
+	redone := entry
+	switch entry.Kind {
+	case JournalRename:
+		if err := redone.trashReplaced(); err != nil {
+			return entry, err
+		}
+		if err := runJournalRenames(entry.Renames); err != nil {
+			return entry, rollback(err, func() error { return restoreAll(redone.Replaced) })
+		}
+		return redone, nil
+
+	case JournalCreate:
+		if err := redone.trashReplaced(); err != nil {
+			return entry, err
+		}
+		if err := restoreTrashed(entry.Trashed); err != nil {
+			return entry, rollback(err, func() error { return restoreAll(redone.Replaced) })
+		}
+		redone.Trashed = nil
+		return redone, nil
+
+	case JournalTrash:
+		var paths []string
+		for _, item := range entry.Trashed {
+			paths = append(paths, item.Original)
+		}
+		items, err := trashOriginals(paths)
+		if err != nil {
+			return entry, err
+		}
+		redone.Trashed = items
+		return redone, nil
+
+	default:
+		return entry, fmt.Errorf("unknown journal entry %v", entry.Kind)
+	}
+}
+
+// entries recorded before the journal was loaded are newer than the loaded ones
+func (self *journal) merge(loaded journal) {
+	if len(self.Undo)+len(self.Redo) == 0 {
+		*self = loaded
+		return
+	}
+	self.Undo = append(loaded.Undo, self.Undo...)
+	if len(self.Undo) > journalSize {
+		self.Undo = self.Undo[len(self.Undo)-journalSize:]
+	}
+}
+
+// merge the loaded journal. it is saved if entries were recorded before, which were not saved
+func (self *model) onJournalLoaded(msg journalLoadedMsg) tea.Cmd {
+	self.journalLoaded = true
+	if msg.err != nil {
+		self.status = newStatus(fmt.Sprintf("loading journal: %v", msg.err), true)
+		return clearStatusCmd(self.status.id)
+	}
+	recorded := len(self.journal.Undo)+len(self.journal.Redo) > 0
+	self.journal.merge(msg.journal)
+	if recorded {
+		return saveJournalCmd(self.journal)
+	}
+	return nil
+}
+
+// save the journal, unless it is still loading; saving then would lose the loaded entries
+func (self *model) saveJournal() tea.Cmd {
+	if !self.journalLoaded {
+		return nil
+	}
+	return saveJournalCmd(self.journal)
+}
+
+// add the entry to the journal and save it
+func (self *model) record(entry journalEntry) tea.Cmd {
+	if !self.journal.record(entry) {
+		return nil
+	}
+	return self.saveJournal()
+}
+
+// the entry is taken off the stack right away, so that it is not undone twice
+func (self *model) undo() tea.Cmd {
+	n := len(self.journal.Undo)
+	if n == 0 {
+		self.status = newStatus("nothing to undo", false)
+		return clearStatusCmd(self.status.id)
+	}
+	entry := self.journal.Undo[n-1]
+	self.journal.Undo = self.journal.Undo[:n-1]
+	return undoCmd(entry)
+}
+
+func (self *model) redo() tea.Cmd {
+	n := len(self.journal.Redo)
+	if n == 0 {
+		self.status = newStatus("nothing to redo", false)
+		return clearStatusCmd(self.status.id)
+	}
+	entry := self.journal.Redo[n-1]
+	self.journal.Redo = self.journal.Redo[:n-1]
+	return redoCmd(entry)
+}
+
+// put the entry on the other stack, or back where it was if it failed
+func (self *model) onJournal(msg journalMsg) tea.Cmd {
+	verb := "undo"
+	from, to := &self.journal.Undo, &self.journal.Redo
+	if !msg.undo {
+		verb = "redo"
+		from, to = &self.journal.Redo, &self.journal.Undo
+	}
+	if msg.err != nil {
+		*from = append(*from, msg.entry)
+		self.status = newStatus(fmt.Sprintf("cannot %s %v: %v", verb, msg.entry, msg.err), true)
+		return tea.Batch(clearStatusCmd(self.status.id), refreshFiles(self.cwd))
+	}
+	*to = append(*to, msg.entry)
+	self.status = newStatus(fmt.Sprintf("%s %v", verb, msg.entry), false)
+	return tea.Batch(clearStatusCmd(self.status.id), self.saveJournal(), refreshFiles(self.cwd))
+}
+
+func undoCmd(entry journalEntry) tea.Cmd {
+	return func() tea.Msg {
+		undone, err := undoEntry(entry)
+		return journalMsg{undone, true, err}
+	}
+}
+
+func redoCmd(entry journalEntry) tea.Cmd {
+	return func() tea.Msg {
+		redone, err := redoEntry(entry)
+		return journalMsg{redone, false, err}
+	}
+}
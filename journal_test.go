@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// a directory for files and a trash in it, on the same filesystem
+func journalDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, ".data"))
+	return dir
+}
+
+func rename(t *testing.T, dir string, from, to string) journalEntry {
+	t.Helper()
+	pair := renamePair{from: filepath.Join(dir, from), to: filepath.Join(dir, to)}
+	if err := os.MkdirAll(filepath.Dir(pair.to), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(pair.from, pair.to); err != nil {
+		t.Fatal(err)
+	}
+	return renameEntry([]renamePair{pair})
+}
+
+func checkFiles(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	got := readFiles(t, dir)
+	delete(got, ".data")
+	for name := range got {
+		if strings.HasPrefix(name, ".data/") {
+			delete(got, name)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestUndoRename(t *testing.T) {
+	dir := journalDir(t)
+	writeFiles(t, dir, map[string]string{"a/x": "X", "a/y": "Y"})
+	entry := rename(t, dir, "a", "b/c")
+
+	undone, err := undoEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{"a/x": "X", "a/y": "Y"})
+	if _, err := redoEntry(undone); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{"b/c/x": "X", "b/c/y": "Y"})
+}
+
+func TestUndoRenameModified(t *testing.T) {
+	dir := journalDir(t)
+	writeFiles(t, dir, map[string]string{"a": "A"})
+	entry := rename(t, dir, "a", "b")
+	writeFiles(t, dir, map[string]string{"b": "changed"})
+
+	if _, err := undoEntry(entry); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("error %v", err)
+	}
+	checkFiles(t, dir, map[string]string{"b": "changed"})
+}
+
+// an overwritten file comes back with undo, and goes to the trash again with redo
+func TestUndoOverwrite(t *testing.T) {
+	dir := journalDir(t)
+	writeFiles(t, dir, map[string]string{"a": "new", "b": "old"})
+	replaced, err := trashPath(filepath.Join(dir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := rename(t, dir, "a", "b")
+	entry.Replaced = []trashItem{replaced}
+
+	undone, err := undoEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{"a": "new", "b": "old"})
+	redone, err := redoEntry(undone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{"b": "new"})
+	if _, err := undoEntry(redone); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{"a": "new", "b": "old"})
+}
+
+// when the overwritten file cannot be restored, the renames are undone too
+func TestUndoRenameRollback(t *testing.T) {
+	dir := journalDir(t)
+	writeFiles(t, dir, map[string]string{"a": "new", "b": "old"})
+	replaced, err := trashPath(filepath.Join(dir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := rename(t, dir, "a", "b")
+	entry.Replaced = []trashItem{replaced}
+	if err := replaced.remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	undone, err := undoEntry(entry)
+	if err == nil || !strings.Contains(err.Error(), "no longer in trash") {
+		t.Errorf("error %v", err)
+	}
+	checkFiles(t, dir, map[string]string{"b": "new"})
+	// the entry is as it was, and can be tried again
+	if len(undone.Renames) != 1 || undone.Renames[0] != entry.Renames[0] {
+		t.Errorf("entry %+v", undone)
+	}
+	if err := checkRenames(reversed(undone.Renames)); err != nil {
+		t.Errorf("the entry cannot be tried again: %v", err)
+	}
+}
+
+func TestUndoCreate(t *testing.T) {
+	dir := journalDir(t)
+	writeFiles(t, dir, map[string]string{"a": "A", "d/x": "X"})
+	entry := createEntry([]string{filepath.Join(dir, "a"), filepath.Join(dir, "d")}, nil)
+
+	undone, err := undoEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{})
+	if len(undone.Trashed) != 2 {
+		t.Errorf("trashed %v", undone.Trashed)
+	}
+	redone, err := redoEntry(undone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{"a": "A", "d/x": "X"})
+	if len(redone.Trashed) != 0 {
+		t.Errorf("trashed %v", redone.Trashed)
+	}
+
+	writeFiles(t, dir, map[string]string{"d/x": "changed"})
+	if _, err := undoEntry(redone); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("error %v", err)
+	}
+	checkFiles(t, dir, map[string]string{"a": "A", "d/x": "changed"})
+}
+
+// when the overwritten file cannot be restored, the created files stay
+func TestUndoCreateRollback(t *testing.T) {
+	dir := journalDir(t)
+	writeFiles(t, dir, map[string]string{"a": "old"})
+	replaced, err := trashPath(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{"a": "new", "b": "B"})
+	entry := createEntry([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, []trashItem{replaced})
+	if err := replaced.remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := undoEntry(entry); err == nil {
+		t.Errorf("no error")
+	}
+	checkFiles(t, dir, map[string]string{"a": "new", "b": "B"})
+	items, _ := listTrash()
+	if len(items) != 0 {
+		t.Errorf("left in trash: %v", items)
+	}
+}
+
+func TestUndoTrash(t *testing.T) {
+	dir := journalDir(t)
+	writeFiles(t, dir, map[string]string{"a": "A", "b": "B"})
+	var items []trashItem
+	for _, name := range []string{"a", "b"} {
+		item, err := trashPath(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	entry := trashEntry(items)
+
+	undone, err := undoEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{"a": "A", "b": "B"})
+	if _, err := redoEntry(undone); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dir, map[string]string{})
+
+	// b came back in the meantime: nothing is restored
+	writeFiles(t, dir, map[string]string{"b": "new"})
+	if _, err := undoEntry(entry); err == nil {
+		t.Errorf("no error")
+	}
+	checkFiles(t, dir, map[string]string{"b": "new"})
+}
+
+func TestJournalRecord(t *testing.T) {
+	var j journal
+	if j.record(journalEntry{Kind: JournalRename}) {
+		t.Errorf("an empty entry is recorded")
+	}
+	j.Redo = []journalEntry{{Kind: JournalTrash}}
+	for i := 0; i < journalSize+5; i++ {
+		j.record(journalEntry{Kind: JournalRename, Renames: []journalRename{{From: "a", To: "b"}}})
+	}
+	if len(j.Undo) != journalSize || j.Redo != nil {
+		t.Errorf("undo %d, redo %d", len(j.Undo), len(j.Redo))
+	}
+}
+
+func TestJournalMerge(t *testing.T) {
+	entry := func(kind string) journalEntry { return journalEntry{Kind: kind} }
+	loaded := journal{Undo: []journalEntry{entry("old")}, Redo: []journalEntry{entry("redo")}}
+
+	var empty journal
+	empty.merge(loaded)
+	if len(empty.Undo) != 1 || len(empty.Redo) != 1 {
+		t.Errorf("merged into an empty journal: %+v", empty)
+	}
+
+	session := journal{Undo: []journalEntry{entry("new")}}
+	session.merge(loaded)
+	if len(session.Undo) != 2 || session.Undo[0].Kind != "old" || session.Undo[1].Kind != "new" || len(session.Redo) != 0 {
+		t.Errorf("merged into a session: %+v", session)
+	}
+}
+
+func TestJournalJSON(t *testing.T) {
+	dir := journalDir(t)
+	writeFiles(t, dir, map[string]string{"a": "A"})
+	item, err := trashPath(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := journal{Undo: []journalEntry{trashEntry([]trashItem{item})}}
+	content, err := json.Marshal(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"name"`, `"trash"`, `"original"`, `"deleted"`} {
+		if !strings.Contains(string(content), key) {
+			t.Errorf("%v is not in %s", key, content)
+		}
+	}
+	var loaded journal
+	if err := json.Unmarshal(content, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Undo[0].Trashed[0]; got.Original != item.Original || !got.Deleted.Equal(item.Deleted) {
+		t.Errorf("got %+v, want %+v", got, item)
+	}
+}
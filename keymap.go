@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// what a key sequence does
+type binding struct {
+	action string
+	arg    string
+}
+
+// bindings by key sequence, keys joined with keySeparator
+type keymap map[string]binding
+
+const keySeparator = "\x00"
+
+// bubbletea names of keys by names that are accepted in <...>
+var keyAliases = map[string]string{
+	"space":  " ",
+	"lt":     "<",
+	"gt":     ">",
+	"cr":     "enter",
+	"return": "enter",
+	"escape": "esc",
+	"bs":     "backspace",
+	"del":    "delete",
+}
+
+// parse a key sequence like "gg", "<c-d>" or "<ctrl+d>x"
+func parseKeys(spec string) (keys []string, err error) {
+	for spec != "" {
+		end := strings.IndexByte(spec, '>')
+		if spec[0] != '<' || end < 2 {
+			r, size := utf8.DecodeRuneInString(spec)
+			keys = append(keys, string(r))
+			spec = spec[size:]
+			continue
+		}
+		name := spec[1:end]
+		spec = spec[end+1:]
+		if utf8.RuneCountInString(name) == 1 {
+			keys = append(keys, name)
+			continue
+		}
+		name = strings.ToLower(name)
+		if alias, ok := keyAliases[name]; ok {
+			keys = append(keys, alias)
+			continue
+		}
+		// vim-like modifiers: c-x, a-x, m-x
+		for _, mod := range []struct{ short, long string }{{"c-", "ctrl+"}, {"a-", "alt+"}, {"m-", "alt+"}, {"ctrl-", "ctrl+"}, {"alt-", "alt+"}} {
+			if strings.HasPrefix(name, mod.short) && len(name) > len(mod.short) {
+				name = mod.long + name[len(mod.short):]
+				break
+			}
+		}
+		keys = append(keys, name)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+	return keys, nil
+}
+
+// format keys as they are written in the config
+func formatKeys(keys []string) string {
+	var s strings.Builder
+	for _, key := range keys {
+		switch {
+		case key == " ":
+			s.WriteString("<space>")
+		case key == "<":
+			s.WriteString("<lt>")
+		case utf8.RuneCountInString(key) == 1:
+			s.WriteString(key)
+		default:
+			s.WriteString("<" + key + ">")
+		}
+	}
+	return s.String()
+}
+
+func (self keymap) bind(keys []string, name string, arg string) error {
+	action, ok := actionByName(name)
+	if !ok {
+		return fmt.Errorf("unknown action %v", name)
+	}
+	if action.arg != "" && arg == "" {
+		return fmt.Errorf("action %v needs an argument: %v", name, action.arg)
+	}
+	if action.arg == "" && arg != "" {
+		return fmt.Errorf("action %v takes no argument", name)
+	}
+	self[strings.Join(keys, keySeparator)] = binding{name, arg}
+	return nil
+}
+
+func (self keymap) unbind(keys []string) error {
+	seq := strings.Join(keys, keySeparator)
+	if _, ok := self[seq]; !ok {
+		return fmt.Errorf("%v is not mapped", formatKeys(keys))
+	}
+	delete(self, seq)
+	return nil
+}
+
+func (self keymap) lookup(keys []string) (binding, bool) {
+	b, ok := self[strings.Join(keys, keySeparator)]
+	return b, ok
+}
+
+// how long a sequence that is both bound and the beginning of a longer one waits for more keys
+const keyTimeout = time.Second
+
+type keyTimeoutMsg struct {
+	id int
+}
+
+func keyTimeoutCmd(id int) tea.Cmd {
+	return tea.Tick(keyTimeout, func(t time.Time) tea.Msg {
+		return keyTimeoutMsg{id}
+	})
+}
+
+// whether keys are the beginning of a longer sequence
+func (self keymap) isPrefix(keys []string) bool {
+	prefix := strings.Join(keys, keySeparator) + keySeparator
+	for seq := range self {
+		if strings.HasPrefix(seq, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// the shortest key sequence that runs the action, formatted
+func (self keymap) keysOf(action string) (keys string, ok bool) {
+	for seq, b := range self {
+		formatted := formatKeys(strings.Split(seq, keySeparator))
+		if b.action == action && (!ok || len(formatted) < len(keys) || len(formatted) == len(keys) && formatted < keys) {
+			keys, ok = formatted, true
+		}
+	}
+	return
+}
+
+// key sequences of every binding, formatted and grouped for the help view.
+// bindings of the same action with different args are grouped if the help does not mention the arg
+func (self keymap) help() (rows [][2]string) {
+	groups := make(map[string][]string)
+	for seq, b := range self {
+		group := b.action
+		if strings.Contains(mustAction(b.action).help, "%s") {
+			group += " " + b.arg
+		}
+		groups[group] = append(groups[group], formatKeys(strings.Split(seq, keySeparator)))
+	}
+	var names []string
+	for name := range groups {
+		names = append(names, name)
+	}
+	// in the order of actions, then by arg
+	order := make(map[string]int)
+	for i, action := range actions {
+		order[action.name] = i
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := strings.Fields(names[i]), strings.Fields(names[j])
+		if order[a[0]] != order[b[0]] {
+			return order[a[0]] < order[b[0]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		keys := groups[name]
+		// shorter sequences first, like j before <down>
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		action, arg, _ := strings.Cut(name, " ")
+		help := mustAction(action).help
+		if strings.Contains(help, "%s") {
+			help = fmt.Sprintf(help, arg)
+		}
+		rows = append(rows, [2]string{strings.Join(keys, " "), help})
+	}
+	return rows
+}
+
+func defaultKeymap() keymap {
+	keys := make(keymap)
+	defaults := []struct{ keys, action, arg string }{
+		{"j", "move-down", ""},
+		{"<down>", "move-down", ""},
+		{"k", "move-up", ""},
+		{"<up>", "move-up", ""},
+		{"<c-d>", "half-page-down", ""},
+		{"<pgdown>", "half-page-down", ""},
+		{"<c-u>", "half-page-up", ""},
+		{"<pgup>", "half-page-up", ""},
+		{"g", "move-top", ""},
+		{"<home>", "move-top", ""},
+		{"G", "move-bottom", ""},
+		{"<end>", "move-bottom", ""},
+		{"h", "updir", ""},
+		{"<left>", "updir", ""},
+		{"l", "open", ""},
+		{"<right>", "open", ""},
+		{"o", "open-external", ""},
+		{"L", "follow-link", ""},
+		{"~", "cd", "~"},
+		{"/", "search", ""},
+		{"n", "search-next", ""},
+		{"N", "search-prev", ""},
+		{"F", "filter", ""},
+		{"<c-f>", "find", ""},
+		{"s", "sort", ""},
+		{"v", "select-down", ""},
+		{"V", "select-up", ""},
+		{"<esc>", "clear-selections", ""},
+		{"p", "paste-copy", ""},
+		{"P", "paste-move", ""},
+		{"S", "paste-symlink", ""},
+		{"<a-s>", "paste-relative-symlink", ""},
+		{"H", "paste-hardlink", ""},
+		{"D", "trash", ""},
+		{"X", "delete", ""},
+		{"a", "create", ""},
+		{"A", "mkdir", ""},
+		{"r", "rename", ""},
+		{"R", "bulk-rename", ""},
+		{"u", "undo", ""},
+		{"<c-r>", "redo", ""},
+		{".", "toggle-hidden", ""},
+		{"d", "toggle-dirsonly", ""},
+		{"f", "toggle-preview", ""},
+		{"<c-l>", "reload", ""},
+		{"T", "trash-view", ""},
+		{"J", "jobs-view", ""},
+		{"<space>", "selections-view", ""},
+		{"E", "errors-view", ""},
+		{"<c-e>", "reload-config", ""},
+		{"?", "help", ""},
+		{"q", "quit", ""},
+		{"<c-c>", "quit", ""},
+		{"Q", "force-quit", ""},
+	}
+	for i := 1; i <= 9; i++ {
+		defaults = append(defaults,
+			struct{ keys, action, arg string }{fmt.Sprint(i), "bookmark", fmt.Sprint(i)},
+			struct{ keys, action, arg string }{fmt.Sprintf("<f%d>", i), "goto-bookmark", fmt.Sprint(i)},
+		)
+	}
+	for _, d := range defaults {
+		seq, err := parseKeys(d.keys)
+		if err == nil {
+			err = keys.bind(seq, d.action, d.arg)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("default keymap: %v: %v", d.keys, err))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"j", []string{"j"}},
+		{"gg", []string{"g", "g"}},
+		{"<c-d>", []string{"ctrl+d"}},
+		{"<C-D>", []string{"ctrl+d"}},
+		{"<ctrl+d>x", []string{"ctrl+d", "x"}},
+		{"<a-s>", []string{"alt+s"}},
+		{"<m-s>", []string{"alt+s"}},
+		{"<space>", []string{" "}},
+		{"<lt><gt>", []string{"<", ">"}},
+		{"<cr><Esc><bs>", []string{"enter", "esc", "backspace"}},
+		{"<x>", []string{"x"}},
+		{"<", []string{"<"}},
+		{"<>", []string{"<", ">"}},
+		{"a<b", []string{"a", "<", "b"}},
+		{"é", []string{"é"}},
+		{"<f1>", []string{"f1"}},
+	}
+	for _, test := range tests {
+		got, err := parseKeys(test.spec)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseKeys(%q) = %q, %v, want %q", test.spec, got, err, test.want)
+		}
+	}
+	if _, err := parseKeys(""); err == nil {
+		t.Errorf("parseKeys(\"\") is not an error")
+	}
+}
+
+func TestFormatKeys(t *testing.T) {
+	for _, spec := range []string{"gg", "<ctrl+d>x", "<space>", "<lt>", "<enter>"} {
+		keys, err := parseKeys(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatKeys(keys); got != spec {
+			t.Errorf("formatKeys(parseKeys(%q)) = %q", spec, got)
+		}
+	}
+}
+
+func TestKeymapSequences(t *testing.T) {
+	keys := make(keymap)
+	for _, spec := range []string{"g", "gh", "zz"} {
+		seq, _ := parseKeys(spec)
+		if err := keys.bind(seq, "quit", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		spec          string
+		bound, prefix bool
+	}{
+		{"g", true, true},
+		{"gh", true, false},
+		{"z", false, true},
+		{"zz", true, false},
+		{"x", false, false},
+	}
+	for _, test := range tests {
+		seq, _ := parseKeys(test.spec)
+		_, bound := keys.lookup(seq)
+		if prefix := keys.isPrefix(seq); bound != test.bound || prefix != test.prefix {
+			t.Errorf("%q: bound %v, prefix %v, want %v, %v", test.spec, bound, prefix, test.bound, test.prefix)
+		}
+	}
+	if err := keys.bind([]string{"x"}, "no-such-action", ""); err == nil {
+		t.Errorf("an unknown action is bound")
+	}
+	if err := keys.unbind([]string{"x"}); err == nil {
+		t.Errorf("an unmapped key is unbound")
+	}
+}
+
+// the model after the update, whether it returned a model or a pointer to one
+func updated(m model, msg tea.Msg) model {
+	next, _ := m.Update(msg)
+	if p, ok := next.(*model); ok {
+		return *p
+	}
+	return next.(model)
+}
+
+// a bound sequence that begins a longer one runs when no more keys come
+func TestKeyTimeout(t *testing.T) {
+	m := newModel(t.TempDir(), initConfig())
+	for _, spec := range []string{"x", "xy"} {
+		seq, _ := parseKeys(spec)
+		if err := m.config.keys.bind(seq, "toggle-hidden", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hidden := m.config.showhidden
+
+	_, cmd := m.onKey("x")
+	if cmd == nil || len(m.pending) != 1 {
+		t.Fatalf("x is not pending")
+	}
+	stale := keyTimeoutMsg{m.pendingId}
+	m.onKey("y")
+	if len(m.pending) != 0 || m.config.showhidden == hidden {
+		t.Fatalf("xy did not run")
+	}
+	if next := updated(m, stale); next.config.showhidden == hidden {
+		t.Errorf("the timeout of x ran after xy")
+	}
+
+	m.onKey("x")
+	next := updated(m, keyTimeoutMsg{m.pendingId})
+	if len(next.pending) != 0 || next.config.showhidden != hidden {
+		t.Errorf("x did not run after the timeout")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// lexer of the config language. a line is a command of words separated by spaces.
+//
+//	'single quotes' are literal, "double quotes" allow escapes and variables,
+//	\ escapes the next char outside of single quotes, and at the end of a line continues it,
+//	$VAR and ${VAR} are replaced with environment variables outside of single quotes,
+//	~ at the start of an unquoted word is the home directory,
+//	# starts a comment at the start of a line or when a space follows it (so #ff0000 is a word).
+
+type token struct {
+	text      string
+	line, col int
+}
+
+// an error at a position of a config file
+type configError struct {
+	file      string
+	line, col int
+	msg       string
+}
+
+func (self configError) Error() string {
+	if self.col == 0 {
+		return fmt.Sprintf("%s:%d: %s", self.file, self.line, self.msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", self.file, self.line, self.col, self.msg)
+}
+
+func isVarRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+type lexer struct {
+	file      string
+	src       []rune
+	pos       int
+	line, col int
+}
+
+func (self *lexer) peek(i int) rune {
+	if self.pos+i >= len(self.src) {
+		return 0
+	}
+	return self.src[self.pos+i]
+}
+
+func (self *lexer) next() rune {
+	r := self.src[self.pos]
+	self.pos++
+	if r == '\n' {
+		self.line++
+		self.col = 1
+	} else {
+		self.col++
+	}
+	return r
+}
+
+func (self *lexer) eof() bool {
+	return self.pos >= len(self.src)
+}
+
+func (self *lexer) errorf(line, col int, format string, args ...any) error {
+	return configError{self.file, line, col, fmt.Sprintf(format, args...)}
+}
+
+// read $VAR or ${VAR} after the $; returns false if it is a literal $
+func (self *lexer) variable() (string, bool, error) {
+	line, col := self.line, self.col-1
+	if self.peek(0) == '{' {
+		end := -1
+		for i := self.pos + 1; i < len(self.src) && self.src[i] != '\n'; i++ {
+			if self.src[i] == '}' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", false, self.errorf(line, col, "unterminated ${")
+		}
+		name := string(self.src[self.pos+1 : end])
+		for self.pos <= end {
+			self.next()
+		}
+		return os.Getenv(name), true, nil
+	}
+	start := self.pos
+	for !self.eof() && isVarRune(self.peek(0)) {
+		self.next()
+	}
+	if self.pos == start {
+		return "", false, nil
+	}
+	return os.Getenv(string(self.src[start:self.pos])), true, nil
+}
+
+// split src into commands, each a list of words.
+// a line with an error is skipped, and lexing goes on with the next one
+func lexConfig(file string, src string) (commands [][]token, errs []error) {
+	l := &lexer{file: file, src: []rune(src), line: 1, col: 1}
+	var command []token
+	for {
+		// between words
+		for !l.eof() && (l.peek(0) == ' ' || l.peek(0) == '\t' || l.peek(0) == '\r') {
+			l.next()
+		}
+		if l.eof() || l.peek(0) == '\n' {
+			if len(command) > 0 {
+				commands = append(commands, command)
+				command = nil
+			}
+			if l.eof() {
+				return commands, errs
+			}
+			l.next()
+			continue
+		}
+		if l.peek(0) == '\\' && l.peek(1) == '\n' {
+			l.next()
+			l.next()
+			continue
+		}
+		if l.peek(0) == '#' && (len(command) == 0 || unicode.IsSpace(l.peek(1)) || l.pos+1 == len(l.src)) {
+			l.skipLine()
+			continue
+		}
+
+		word, err := l.word()
+		if err != nil {
+			errs = append(errs, err)
+			command = nil
+			l.skipLine()
+			continue
+		}
+		command = append(command, word)
+	}
+}
+
+func (self *lexer) skipLine() {
+	for !self.eof() && self.peek(0) != '\n' {
+		self.next()
+	}
+}
+
+func (self *lexer) word() (token, error) {
+	tok := token{line: self.line, col: self.col}
+	var text strings.Builder
+	if self.peek(0) == '~' && (self.peek(1) == '/' || self.peek(1) == 0 || unicode.IsSpace(self.peek(1))) {
+		self.next()
+		home, _ := os.UserHomeDir()
+		text.WriteString(home)
+	}
+	for !self.eof() {
+		r := self.peek(0)
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			tok.text = text.String()
+			return tok, nil
+
+		case r == '\\':
+			self.next()
+			if self.eof() {
+				return tok, self.errorf(self.line, self.col, "escape at the end of file")
+			}
+			if self.peek(0) == '\n' {
+				self.next() // continued line
+				continue
+			}
+			text.WriteRune(self.next())
+
+		case r == '\'':
+			line, col := self.line, self.col
+			self.next()
+			for {
+				if self.eof() || self.peek(0) == '\n' {
+					return tok, self.errorf(line, col, "unterminated quote")
+				}
+				if r := self.next(); r == '\'' {
+					break
+				} else {
+					text.WriteRune(r)
+				}
+			}
+
+		case r == '"':
+			line, col := self.line, self.col
+			self.next()
+		quoted:
+			for {
+				if self.eof() || self.peek(0) == '\n' {
+					return tok, self.errorf(line, col, "unterminated quote")
+				}
+				switch r := self.next(); r {
+				case '"':
+					break quoted
+				case '\\':
+					switch e := self.peek(0); e {
+					case 'n':
+						text.WriteRune('\n')
+					case 't':
+						text.WriteRune('\t')
+					case '\\', '"', '$':
+						text.WriteRune(e)
+					default:
+						text.WriteRune('\\')
+						continue
+					}
+					self.next()
+				case '$':
+					value, ok, err := self.variable()
+					if err != nil {
+						return tok, err
+					}
+					if !ok {
+						value = "$"
+					}
+					text.WriteString(value)
+				default:
+					text.WriteRune(r)
+				}
+			}
+
+		case r == '$':
+			self.next()
+			value, ok, err := self.variable()
+			if err != nil {
+				return tok, err
+			}
+			if !ok {
+				value = "$"
+			}
+			text.WriteString(value)
+
+		default:
+			text.WriteRune(self.next())
+		}
+	}
+	tok.text = text.String()
+	return tok, nil
+}
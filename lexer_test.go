@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func words(commands [][]token) [][]string {
+	var result [][]string
+	for _, command := range commands {
+		var line []string
+		for _, tok := range command {
+			line = append(line, tok.text)
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+func TestLexConfig(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+	t.Setenv("EDITOR", "vim")
+	t.Setenv("EMPTY", "")
+
+	tests := []struct {
+		name string
+		src  string
+		want [][]string
+	}{
+		{"words", "set  ratios\t1:2:3", [][]string{{"set", "ratios", "1:2:3"}}},
+		{"lines", "set a\n\nset b\r\n", [][]string{{"set", "a"}, {"set", "b"}}},
+		{"single quotes", `map x 'a  b' '$EDITOR\n'`, [][]string{{"map", "x", "a  b", `$EDITOR\n`}}},
+		{"double quotes", `cmd "a\tb\n" "\"\\\$" "\q"`, [][]string{{"cmd", "a\tb\n", `"\$`, `\q`}}},
+		{"escapes", `a\ b \'c\'`, [][]string{{"a b", "'c'"}}},
+		{"continued line", "set a \\\n  b\nset c\\\nd", [][]string{{"set", "a", "b"}, {"set", "cd"}}},
+		{"variables", `$EDITOR ${EDITOR}s "x$EDITOR" "${EMPTY}y" $UNSET_VARIABLE_XYZ`, [][]string{{"vim", "vims", "xvim", "y", ""}}},
+		{"literal dollar", `$ a$ "$" "$."`, [][]string{{"$", "a$", "$", "$."}}},
+		{"tilde", `~ ~/x a~ '~' "~" ~user`, [][]string{{"/home/user", "/home/user/x", "a~", "~", "~", "~user"}}},
+		{"comments", "# comment\nset x # trailing\n  # indented", [][]string{{"set", "x"}}},
+		{"hash in words", "color fg #ff0000 a#b\nset x #", [][]string{{"color", "fg", "#ff0000", "a#b"}, {"set", "x"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			commands, errs := lexConfig("config", test.src)
+			if len(errs) > 0 {
+				t.Fatalf("errors: %v", errs)
+			}
+			if got := words(commands); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLexConfigPositions(t *testing.T) {
+	commands, _ := lexConfig("config", "set a\n  map  'x y'")
+	want := [][2]int{{1, 1}, {1, 5}, {2, 3}, {2, 8}}
+	var got [][2]int
+	for _, command := range commands {
+		for _, tok := range command {
+			got = append(got, [2]int{tok.line, tok.col})
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLexConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string     // the error
+		rest [][]string // commands of the other lines
+	}{
+		{"single quote", "set 'abc", "config:1:5: unterminated quote", nil},
+		{"double quote", "set a\nset b \"x\nset c", "config:2:7: unterminated quote", [][]string{{"set", "a"}, {"set", "c"}}},
+		{"quote at line end", "set 'a\nb", "config:1:5: unterminated quote", [][]string{{"b"}}},
+		{"variable", "set ${EDITOR x", "config:1:5: unterminated ${", nil},
+		{"quoted variable", `set "a${EDITOR"`, "config:1:7: unterminated ${", nil},
+		{"escape at the end", `set x\`, "config:1:7: escape at the end of file", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			commands, errs := lexConfig("config", test.src)
+			if len(errs) != 1 || errs[0].Error() != test.want {
+				t.Errorf("errors %v, want %v", errs, test.want)
+			}
+			if got := words(commands); !reflect.DeepEqual(got, test.rest) {
+				t.Errorf("got %q, want %q", got, test.rest)
+			}
+		})
+	}
+}
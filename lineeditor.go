@@ -0,0 +1,141 @@
+package main
+
+import (
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+// single line text input with readline-like keys
+type lineEditor struct {
+	value []rune
+	pos   int
+
+	history []string // oldest first
+	histPos int      // len(history) when not browsing history
+	saved   []rune   // input before browsing history
+}
+
+func newLineEditor(initial string, history []string) lineEditor {
+	value := []rune(initial)
+	return lineEditor{value: value, pos: len(value), history: history, histPos: len(history)}
+}
+
+func (self *lineEditor) String() string {
+	return string(self.value)
+}
+
+func (self *lineEditor) set(value []rune) {
+	self.value = value
+	self.pos = len(value)
+}
+
+func (self *lineEditor) insert(runes []rune) {
+	value := make([]rune, 0, len(self.value)+len(runes))
+	value = append(value, self.value[:self.pos]...)
+	value = append(value, runes...)
+	value = append(value, self.value[self.pos:]...)
+	self.value = value
+	self.pos += len(runes)
+}
+
+// delete runes between the positions
+func (self *lineEditor) delete(from, to int) {
+	from, to = max(0, min(from, to)), min(len(self.value), max(from, to))
+	self.value = append(self.value[:from:from], self.value[to:]...)
+	self.pos = from
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// start of the word before the cursor
+func (self *lineEditor) wordLeft() int {
+	i := self.pos
+	for i > 0 && !isWordRune(self.value[i-1]) {
+		i--
+	}
+	for i > 0 && isWordRune(self.value[i-1]) {
+		i--
+	}
+	return i
+}
+
+// end of the word after the cursor
+func (self *lineEditor) wordRight() int {
+	i := self.pos
+	for i < len(self.value) && !isWordRune(self.value[i]) {
+		i++
+	}
+	for i < len(self.value) && isWordRune(self.value[i]) {
+		i++
+	}
+	return i
+}
+
+func (self *lineEditor) historyMove(i int) {
+	pos := self.histPos + i
+	if pos < 0 || pos > len(self.history) {
+		return
+	}
+	if self.histPos == len(self.history) {
+		self.saved = self.value
+	}
+	self.histPos = pos
+	if pos == len(self.history) {
+		self.set(self.saved)
+	} else {
+		self.set([]rune(self.history[pos]))
+	}
+}
+
+// returns true if the key was handled
+func (self *lineEditor) onKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "left", "ctrl+b":
+		self.pos = max(self.pos-1, 0)
+	case "right", "ctrl+f":
+		self.pos = min(self.pos+1, len(self.value))
+	case "home", "ctrl+a":
+		self.pos = 0
+	case "end", "ctrl+e":
+		self.pos = len(self.value)
+	case "alt+b", "ctrl+left":
+		self.pos = self.wordLeft()
+	case "alt+f", "ctrl+right":
+		self.pos = self.wordRight()
+	case "backspace", "ctrl+h":
+		self.delete(self.pos-1, self.pos)
+	case "delete", "ctrl+d":
+		self.delete(self.pos, self.pos+1)
+	case "ctrl+w", "alt+backspace":
+		self.delete(self.wordLeft(), self.pos)
+	case "alt+d":
+		self.delete(self.pos, self.wordRight())
+	case "ctrl+u":
+		self.delete(0, self.pos)
+	case "ctrl+k":
+		self.delete(self.pos, len(self.value))
+	case "up", "ctrl+p":
+		self.historyMove(-1)
+	case "down", "ctrl+n":
+		self.historyMove(1)
+	default:
+		if msg.Type == tea.KeyRunes && !msg.Alt || msg.Type == tea.KeySpace {
+			self.insert(msg.Runes)
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func (self *lineEditor) View() string {
+	cursor := lipgloss.NewStyle().Reverse(true)
+	if self.pos == len(self.value) {
+		return string(self.value) + cursor.Render(" ")
+	}
+	return string(self.value[:self.pos]) + cursor.Render(string(self.value[self.pos])) + string(self.value[self.pos+1:])
+}
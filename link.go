@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/sys/unix"
+)
+
+type LinkKind byte
+
+const (
+	LinkAbsolute LinkKind = iota
+	LinkRelative
+	LinkHard
+)
+
+type linkFilesMsg struct {
+	entry journalEntry
+	err   error
+}
+
+func linkFilesCmd(selections set[string], toPath string, kind LinkKind, policy ConflictPolicy) tea.Cmd {
+	paths := selections.Values()
+	op := newFileop("linking")
+	op.policy = policy
+	return op.start(func() (tea.Msg, error) {
+		err := op.linkAll(paths, toPath, kind)
+		return linkFilesMsg{createEntry(op.created, op.replaced), err}, err
+	})
+}
+
+// path of target relative to the directory dir, through the real locations of both,
+// so that dir being a symlink itself does not break the link
+func relativeTarget(target, dir string) (string, error) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	// the target itself can be a symlink, then the link points to the link
+	realTargetDir, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(realDir, filepath.Join(realTargetDir, filepath.Base(target)))
+}
+
+// create a link in dir for every path; errors are collected per path
+func (self *fileop) linkAll(paths []string, dir string, kind LinkKind) error {
+	self.count = true
+	self.total = int64(len(paths))
+	var errs []error
+	for _, src := range paths {
+		if err := self.ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		self.file = src
+		self.report()
+		err := self.linkPath(src, filepath.Join(dir, filepath.Base(src)), kind)
+		self.done++
+		if err != nil && err != errSkipped {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (self *fileop) linkPath(src, dst string, kind LinkKind) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if kind == LinkHard && info.IsDir() {
+		return fmt.Errorf("%v: cannot hard link a directory", src)
+	}
+	path, overwrite, err := self.resolve(src, dst)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case LinkAbsolute:
+		err = os.Symlink(src, path)
+	case LinkRelative:
+		var target string
+		target, err = relativeTarget(src, filepath.Dir(path))
+		if err == nil {
+			err = os.Symlink(target, path)
+		}
+	case LinkHard:
+		err = os.Link(src, path)
+		if errors.Is(err, unix.EXDEV) {
+			err = fmt.Errorf("%v: cannot hard link to %v, it is on another device", src, filepath.Dir(path))
+		}
+	}
+	if err == nil && overwrite {
+		var item trashItem
+		if item, err = replace(path, dst); err == nil {
+			self.replaced = append(self.replaced, item)
+		} else {
+			os.Remove(path)
+		}
+		path = dst
+	}
+	if err != nil {
+		return err
+	}
+	self.created = append(self.created, path)
+	return nil
+}
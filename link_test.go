@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelativeTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a/b/f": "F", "c/g": "G"})
+	for _, link := range [][2]string{{"a/b", "ab"}, {"c/g", "c/glink"}} {
+		if err := os.Symlink(filepath.Join(dir, link[0]), filepath.Join(dir, link[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct{ target, dir, want string }{
+		{"a/b/f", "c", "../a/b/f"},
+		{"a/b/f", "a/b", "f"},
+		{"c/g", "a/b", "../../c/g"},
+		// the link is made in the real directory that ab points to
+		{"c/g", "ab", "../../c/g"},
+		{"ab/f", "c", "../a/b/f"},
+		// a symlink target is linked itself, not what it points to
+		{"c/glink", "a", "../c/glink"},
+	}
+	for _, test := range tests {
+		got, err := relativeTarget(filepath.Join(dir, test.target), filepath.Join(dir, test.dir))
+		if err != nil || got != test.want {
+			t.Errorf("relativeTarget(%q, %q) = %q, %v, want %q", test.target, test.dir, got, err, test.want)
+		}
+		// the link resolves to the target; joined without cleaning, as the system resolves it
+		if err == nil {
+			want, _ := os.Lstat(filepath.Join(dir, test.target))
+			if info, err := os.Lstat(filepath.Join(dir, test.dir) + "/" + got); err != nil || !os.SameFile(info, want) {
+				t.Errorf("%q in %q does not resolve to the target: %v", got, test.dir, err)
+			}
+		}
+	}
+	if _, err := relativeTarget(filepath.Join(dir, "a/b/f"), filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("a missing directory is not an error")
+	}
+}
+
+func TestLinkPath(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a/f": "F"})
+	if err := os.Mkdir(filepath.Join(dir, "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "a", "f")
+	tests := []struct {
+		kind LinkKind
+		name string
+		want string // target of the symlink, "" for a hard link
+	}{
+		{LinkAbsolute, "abs", src},
+		{LinkRelative, "rel", "../a/f"},
+		{LinkHard, "hard", ""},
+	}
+	op := newFileop("linking")
+	op.policy = ConflictSkip
+	for _, test := range tests {
+		dst := filepath.Join(dir, "b", test.name)
+		if err := op.linkPath(src, dst, test.kind); err != nil {
+			t.Fatal(err)
+		}
+		target, err := os.Readlink(dst)
+		if test.want == "" {
+			a, _ := os.Stat(src)
+			b, _ := os.Lstat(dst)
+			if err == nil || !os.SameFile(a, b) {
+				t.Errorf("%v is not a hard link", test.name)
+			}
+		} else if target != test.want {
+			t.Errorf("%v links to %q, %v, want %q", test.name, target, err, test.want)
+		}
+	}
+	if len(op.created) != len(tests) {
+		t.Errorf("created %v", op.created)
+	}
+	if err := op.linkPath(filepath.Join(dir, "a"), filepath.Join(dir, "b", "dir"), LinkHard); err == nil {
+		t.Errorf("a directory is hard linked")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+// file name colors from the LS_COLORS variable, as dircolors(1) writes it
+
+// a parsed SGR sequence like "01;38;5;208"
+type sgrStyle struct {
+	fg, bg                                                 lipgloss.TerminalColor
+	bold, faint, italic, underline, blink, reverse, strike bool
+}
+
+type lsColors struct {
+	types map[string]sgrStyle // by two-letter file type
+	exts  []lsExt             // in the order of the variable
+	// ln=target: links look like their targets
+	linkTarget bool
+}
+
+type lsExt struct {
+	suffix string // lower case
+	style  sgrStyle
+}
+
+// ansi color of a 30-37, 90-97 or 40-47, 100-107 code
+func basicColor(code, base int) lipgloss.TerminalColor {
+	if code >= base+60 {
+		return lipgloss.Color(strconv.Itoa(code - base - 60 + 8))
+	}
+	return lipgloss.Color(strconv.Itoa(code - base))
+}
+
+// parse an SGR parameter list; unknown codes are ignored
+func parseSGR(s string) (style sgrStyle) {
+	params := strings.Split(s, ";")
+	for i := 0; i < len(params); i++ {
+		code, err := strconv.Atoi(params[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case code == 0:
+			style = sgrStyle{}
+		case code == 1:
+			style.bold = true
+		case code == 2:
+			style.faint = true
+		case code == 3:
+			style.italic = true
+		case code == 4:
+			style.underline = true
+		case code == 5 || code == 6:
+			style.blink = true
+		case code == 7:
+			style.reverse = true
+		case code == 9:
+			style.strike = true
+		case code >= 30 && code <= 37 || code >= 90 && code <= 97:
+			style.fg = basicColor(code, 30)
+		case code >= 40 && code <= 47 || code >= 100 && code <= 107:
+			style.bg = basicColor(code, 40)
+		case code == 39:
+			style.fg = nil
+		case code == 49:
+			style.bg = nil
+		case code == 38 || code == 48:
+			// 38;5;n or 38;2;r;g;b
+			var color lipgloss.TerminalColor
+			if i+2 < len(params) && params[i+1] == "5" {
+				color = lipgloss.Color(params[i+2])
+				i += 2
+			} else if i+4 < len(params) && params[i+1] == "2" {
+				var rgb [3]int
+				for j := range rgb {
+					rgb[j], _ = strconv.Atoi(params[i+2+j])
+				}
+				color = lipgloss.Color("#" + hexByte(rgb[0]) + hexByte(rgb[1]) + hexByte(rgb[2]))
+				i += 4
+			} else {
+				continue
+			}
+			if code == 38 {
+				style.fg = color
+			} else {
+				style.bg = color
+			}
+		}
+	}
+	return style
+}
+
+func hexByte(n int) string {
+	s := strconv.FormatInt(int64(max(0, min(n, 255))), 16)
+	if len(s) == 1 {
+		s = "0" + s
+	}
+	return s
+}
+
+func (self sgrStyle) apply(base lipgloss.Style) lipgloss.Style {
+	if self.fg != nil {
+		base = base.Foreground(self.fg)
+	}
+	if self.bg != nil {
+		base = base.Background(self.bg)
+	}
+	if self.bold {
+		base = base.Bold(true)
+	}
+	if self.faint {
+		base = base.Faint(true)
+	}
+	if self.italic {
+		base = base.Italic(true)
+	}
+	if self.underline {
+		base = base.Underline(true)
+	}
+	if self.blink {
+		base = base.Blink(true)
+	}
+	if self.reverse {
+		base = base.Reverse(true)
+	}
+	if self.strike {
+		base = base.Strikethrough(true)
+	}
+	return base
+}
+
+// nil if the variable is not set
+func parseLSColors(value string) *lsColors {
+	if value == "" {
+		return nil
+	}
+	colors := &lsColors{types: make(map[string]sgrStyle)}
+	for _, entry := range strings.Split(value, ":") {
+		key, sgr, ok := strings.Cut(entry, "=")
+		if !ok || key == "" {
+			continue
+		}
+		if strings.HasPrefix(key, "*") {
+			colors.exts = append(colors.exts, lsExt{strings.ToLower(key[1:]), parseSGR(sgr)})
+			continue
+		}
+		if key == "ln" && sgr == "target" {
+			colors.linkTarget = true
+			continue
+		}
+		colors.types[key] = parseSGR(sgr)
+	}
+	return colors
+}
+
+func lsColorsFromEnv() *lsColors {
+	return parseLSColors(os.Getenv("LS_COLORS"))
+}
+
+// the type key for the mode, or "" for regular files without a special type
+func lsType(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return "ln"
+	case mode.IsDir():
+		switch {
+		case mode&fs.ModeSticky != 0 && mode&0002 != 0:
+			return "tw"
+		case mode&0002 != 0:
+			return "ow"
+		case mode&fs.ModeSticky != 0:
+			return "st"
+		}
+		return "di"
+	case mode&fs.ModeNamedPipe != 0:
+		return "pi"
+	case mode&fs.ModeSocket != 0:
+		return "so"
+	case mode&fs.ModeDevice != 0 && mode&fs.ModeCharDevice != 0:
+		return "cd"
+	case mode&fs.ModeDevice != 0:
+		return "bd"
+	case mode&fs.ModeSetuid != 0:
+		return "su"
+	case mode&fs.ModeSetgid != 0:
+		return "sg"
+	case mode&0111 != 0:
+		return "ex"
+	}
+	return ""
+}
+
+// style of a file like ls would color it
+func (self *lsColors) style(file File) (sgrStyle, bool) {
+	mode := file.Mode
+	if file.IsLink {
+		if file.Broken {
+			if style, ok := self.types["or"]; ok {
+				return style, true
+			}
+		} else if self.linkTarget {
+			mode = file.TargetMode
+		}
+	}
+	// the dir-like types fall back to di, the regular ones to extensions
+	typ := lsType(mode)
+	if style, ok := self.types[typ]; ok {
+		return style, true
+	}
+	if mode.IsDir() {
+		style, ok := self.types["di"]
+		return style, ok
+	}
+	if typ != "" && typ != "su" && typ != "sg" && typ != "ex" {
+		return sgrStyle{}, false
+	}
+	// later entries override earlier ones
+	name := strings.ToLower(file.Name)
+	for i := len(self.exts) - 1; i >= 0; i-- {
+		if strings.HasSuffix(name, self.exts[i].suffix) {
+			return self.exts[i].style, true
+		}
+	}
+	style, ok := self.types["fi"]
+	return style, ok
+}
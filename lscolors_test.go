@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/fs"
+	"testing"
+
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+func TestParseSGR(t *testing.T) {
+	tests := []struct {
+		sgr  string
+		want sgrStyle
+	}{
+		{"", sgrStyle{}},
+		{"01;34", sgrStyle{fg: lipgloss.Color("4"), bold: true}},
+		{"91;100", sgrStyle{fg: lipgloss.Color("9"), bg: lipgloss.Color("8")}},
+		{"38;5;208", sgrStyle{fg: lipgloss.Color("208")}},
+		{"48;2;255;0;16", sgrStyle{bg: lipgloss.Color("#ff0010")}},
+		{"38;2;300;1", sgrStyle{bold: true, faint: true}}, // too short, the rest are plain codes
+		{"2;3;4;5;7;9", sgrStyle{faint: true, italic: true, underline: true, blink: true, reverse: true, strike: true}},
+		{"1;31;0;4", sgrStyle{underline: true}},
+		{"31;41;39;49", sgrStyle{}},
+		{"x;1;;32", sgrStyle{fg: lipgloss.Color("2"), bold: true}},
+	}
+	for _, test := range tests {
+		if got := parseSGR(test.sgr); got != test.want {
+			t.Errorf("parseSGR(%q) = %+v, want %+v", test.sgr, got, test.want)
+		}
+	}
+}
+
+func TestLSColorsStyle(t *testing.T) {
+	colors := parseLSColors("rs=0:di=01;34:ow=34;42:ln=target:or=31:ex=32:fi=0:*.tar=33:*.TAR.GZ=35:*.gz=36:bad:=1")
+	tests := []struct {
+		name string
+		file File
+		want sgrStyle
+		ok   bool
+	}{
+		{"dir", File{Name: "dir", Mode: fs.ModeDir | 0755}, sgrStyle{fg: lipgloss.Color("4"), bold: true}, true},
+		{"other writable", File{Name: "tmp", Mode: fs.ModeDir | 0777}, sgrStyle{fg: lipgloss.Color("4"), bg: lipgloss.Color("2")}, true},
+		{"sticky falls back to dir", File{Name: "tmp", Mode: fs.ModeDir | fs.ModeSticky | 0755}, sgrStyle{fg: lipgloss.Color("4"), bold: true}, true},
+		{"extension", File{Name: "a.tar", Mode: 0644}, sgrStyle{fg: lipgloss.Color("3")}, true},
+		{"later extension wins", File{Name: "a.tar.gz", Mode: 0644}, sgrStyle{fg: lipgloss.Color("6")}, true},
+		{"case of extension", File{Name: "A.TAR", Mode: 0644}, sgrStyle{fg: lipgloss.Color("3")}, true},
+		{"executable", File{Name: "run.tar", Mode: 0755}, sgrStyle{fg: lipgloss.Color("2")}, true},
+		{"regular", File{Name: "notes", Mode: 0644}, sgrStyle{}, true},
+		{"link as target", File{Name: "link", Mode: fs.ModeSymlink | 0777, IsLink: true, TargetMode: fs.ModeDir | 0755}, sgrStyle{fg: lipgloss.Color("4"), bold: true}, true},
+		{"broken link", File{Name: "link", Mode: fs.ModeSymlink | 0777, IsLink: true, Broken: true}, sgrStyle{fg: lipgloss.Color("1")}, true},
+		{"pipe", File{Name: "fifo.tar", Mode: fs.ModeNamedPipe | 0644}, sgrStyle{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := colors.style(test.file)
+			if got != test.want || ok != test.ok {
+				t.Errorf("got %+v, %v, want %+v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestParseLSColorsEmpty(t *testing.T) {
+	if colors := parseLSColors(""); colors != nil {
+		t.Errorf("got %+v, want nil", colors)
+	}
+}
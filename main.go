@@ -1,20 +1,37 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/muesli/termenv"
+	"golang.org/x/sys/unix"
 )
 
 const version = "v0.1.0"
 
+// send the size of the terminal at the start and whenever it changes. tea does this only
+// when its output is a terminal, and the output is screen, which writes to one
+func watchSize(program *tea.Program) {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, unix.SIGWINCH)
+	for {
+		ws, err := unix.IoctlGetWinsize(int(os.Stderr.Fd()), unix.TIOCGWINSZ)
+		if err == nil {
+			program.Send(tea.WindowSizeMsg{Width: int(ws.Col), Height: int(ws.Row)})
+		}
+		<-resized
+	}
+}
+
 func getInitialCwd() string {
 	var err error
 	cwd, err := os.Getwd()
@@ -33,6 +50,7 @@ func main() {
 	configFile := flag.String("config", "", "path to config file")
 	versionFlag := flag.Bool("version", false, "print version and exit")
 	logpath := flag.String("log", "", "print log to file")
+	checkConfig := flag.Bool("check-config", false, "print errors of the config file and exit")
 
 	flag.Usage = func() {
 		fmt.Printf("bubblefm %v, a simple file manager\n", version)
@@ -41,6 +59,8 @@ func main() {
 		fmt.Println("\t-help: print help and exit")
 		fmt.Println("\t-version: print version and exit")
 		fmt.Println("\t-log: logging file")
+		fmt.Println("\t-config: config file (default: $XDG_CONFIG_HOME/bubblefm/config)")
+		fmt.Println("\t-check-config: print errors of the config file and exit, non-zero if there are any")
 	}
 
 	flag.Parse()
@@ -73,19 +93,41 @@ func main() {
 		log.SetOutput(io.Discard)
 	}
 
-	if *configFile == "" {
+	// a missing config is only an error if it was asked for
+	defaultConfig := *configFile == ""
+	if defaultConfig {
 		configdir, err := os.UserConfigDir()
 		if err != nil {
 			panic("could not get user config dir")
 		}
 		*configFile = filepath.Join(configdir, "bubblefm", "config")
 	}
+	// the ui is drawn on stderr, so colors are detected there
+	lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(os.Stderr))
+	// the background is queried before the program reads the terminal; it is cached for "theme auto" on reload
+	lipgloss.HasDarkBackground()
 	config := initConfig()
-	_ = config.source(*configFile) // who cares about the errors? it's a user's problem.
+	errs := config.source(*configFile)
+	if len(errs) == 1 && errors.Is(errs[0], fs.ErrNotExist) && defaultConfig && !*checkConfig {
+		errs = nil
+	}
+
+	if *checkConfig {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
-	lipgloss.SetColorProfile(termenv.ANSI256)
 	m := newModel(cwd, config)
-	program := tea.NewProgram(m, tea.WithOutput(os.Stderr), tea.WithAltScreen())
+	m.configPath = *configFile
+	m.configModified = modTime(*configFile)
+	m.reportConfigErrors(errs)
+	program := tea.NewProgram(m, tea.WithOutput(screen), tea.WithAltScreen())
+	go watchSize(program)
 	_, err := program.Run()
 	if err != nil {
 		panic(err)
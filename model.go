@@ -3,9 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -32,10 +33,36 @@ type model struct {
 	selections set[string]
 	bookmarks  map[string]string
 
-	config config
+	trash       []trashItem
+	trashCursor int
+
+	jobs       []*job
+	jobsCursor int
+
+	journal       journal
+	journalLoaded bool // entries are not saved before, they would overwrite the file
+
+	filters map[string]fileFilter // by directory
+	search  string                // last search pattern
+	matcher *regexp.Regexp        // of the search, compiled once; nil if there is none
+
+	config         config
+	configErrors   []error // from sourcing the config
+	configPath     string
+	configModified time.Time // of the file, when it was sourced
+	sourced        config    // as it was sourced, before toggles at runtime
+	watching       bool      // whether the config file is polled
 
 	currentView ViewType
 	status      status
+	prompt      *prompt
+	prompts     []*prompt // waiting for the open one to close
+	pending     []string  // keys of an incomplete sequence
+	pendingId   int       // of the sequence, for its timeout
+	helpOffset  int
+	finder      *finder
+	image       *terminalImage      // of the preview, if it is drawn over it
+	history     map[string][]string // inputs of prompts
 }
 
 func defaultBookmarks() map[string]string {
@@ -100,6 +127,11 @@ func (self *model) visibleFiles() (files []File) {
 			return f.IsDir
 		})
 	}
+	if f, ok := self.filters[self.cwd]; ok {
+		files = filter(&files, func(file File) bool {
+			return f.matches(file.Name)
+		})
+	}
 	return files
 }
 
@@ -156,6 +188,17 @@ func (self *model) sortFiles() {
 	}
 }
 
+// move cursor to the file with the name, if it is visible
+func (self *model) focus(name string) {
+	for i, file := range self.visibleFiles() {
+		if file.Name == name {
+			self.cursor = i
+			self.syncBounds()
+			return
+		}
+	}
+}
+
 func (self model) current() File {
 	// TODO: return (ok bool, File)?
 	if self.empty {
@@ -176,184 +219,224 @@ func (self model) open() (model, tea.Cmd) {
 	}
 }
 
-func (self model) sortby(s SortType) {
+// sort and keep the cursor on the same file
+func (self *model) sortby(s SortType) {
 	switch s {
 	case SortName:
-		self.status = newStatus("sort by time", false)
+		self.status = newStatus("sort by name", false)
 	case SortModified:
 		self.status = newStatus("sort by time", false)
 	case SortSize:
-		self.status = newStatus("sort by time", false)
+		self.status = newStatus("sort by size", false)
 	default:
 		panic("unknown SortType")
 	}
+	var name string
+	if !self.empty {
+		name = self.current().Name
+	}
 	self.config.sort = s
 	self.sortFiles()
+	self.focus(name)
 }
 
 func (self *model) refreshPreview() (model, tea.Cmd) {
 	self.preview = []string{"..."}
 	var cmd tea.Cmd
 	if !self.empty {
-		cmd = previewCmd(self.current().Path)
+		images := self.config.imagepreview
+		if images == ImageAuto {
+			images = detectImageProtocol()
+		}
+		cmd = previewCmd(self.current().Path, previewOptions{
+			style:  self.config.previewtheme,
+			images: images,
+			width:  self.width / 2,
+			height: self.normalHeight(),
+		})
+	}
+	if self.image != nil {
+		if self.image.shown {
+			self.clearImage()
+		}
+		self.image = nil
 	}
 	return *self, cmd
 }
 
-func (self *model) onKey(key string) (tea.Model, tea.Cmd) {
-	if self.currentView == ViewHelp {
-		self.currentView = ViewFiles
-		return self, nil
-	}
-
-	if self.currentView == ViewSelections {
-		self.currentView = ViewFiles
-		return self, nil
-	}
-
+// keys of the trash browser
+func (self *model) onTrashKey(key string) (tea.Model, tea.Cmd) {
 	switch key {
-
 	case "j", "down":
-		self.moveCursor(1)
-		self.syncBounds()
-		return self.refreshPreview()
-
+		self.trashCursor = max(min(self.trashCursor+1, len(self.trash)-1), 0)
 	case "k", "up":
-		self.moveCursor(-1)
-		self.syncBounds()
-		return self.refreshPreview()
-
-	case "ctrl+d", "pgdown":
-		self.moveCursor((self.bottomIndex() - self.topIndex) / 2)
-		self.syncBounds()
-		return self.refreshPreview()
-
-	case "ctrl+u", "pgup":
-		self.moveCursor(-(self.bottomIndex() - self.topIndex) / 2)
-		self.syncBounds()
-		return self.refreshPreview()
-
+		self.trashCursor = max(self.trashCursor-1, 0)
 	case "g", "home":
-		self.moveCursor(-self.len())
-		self.syncBounds()
-		return self.refreshPreview()
-
+		self.trashCursor = 0
 	case "G", "end":
-		self.moveCursor(self.len())
-		self.syncBounds()
-		return self.refreshPreview()
-
-	case "n":
-		self.sortby(SortName)
-		return self.refreshPreview()
-
-	case "t":
-		self.sortby(SortModified)
-		return self.refreshPreview()
-
-	case "s":
-		self.sortby(SortSize)
-		return self.refreshPreview()
-
-	case "ctrl+l":
-		return self, refreshFiles(self.cwd)
-
-	case "v":
-		// TODO: save selections to registers?
-		if self.empty {
-			break
+		self.trashCursor = max(len(self.trash)-1, 0)
+	case "r":
+		if len(self.trash) > 0 {
+			return self, restoreTrashCmd(self.trash[self.trashCursor])
 		}
-		self.selections.Toggle(self.current().Path)
-		self.moveCursor(1)
-		return self.refreshPreview()
-
-	case "V":
-		if self.empty {
-			break
+	case "X":
+		if len(self.trash) > 0 {
+			item := self.trash[self.trashCursor]
+			cmd := removeTrashCmd([]trashItem{item})
+			return self, self.confirm("delete", fmt.Sprintf("delete %v permanently?", item.Name), cmd)
 		}
-		self.selections.Toggle(self.current().Path)
-		self.moveCursor(-1)
-		return self.refreshPreview()
-
-	case "esc":
-		self.selections.Clear()
-
-		// TODO: yank paths to clipboard
-		// TODO: marks like in Vim (m + letter, ' + letter, pasting to mark, etc)
-	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
-		self.bookmarks[key] = self.cwd
-
-	case "f1", "f2", "f3", "f4", "f5", "f6", "f7", "f8", "f9":
-		key := string(key[1]) // second byte is the second grapheme in this case
-		path, exists := self.bookmarks[key]
-		if exists {
-			return self, refreshFiles(path)
+	case "E":
+		if len(self.trash) > 0 {
+			cmd := removeTrashCmd(self.trash)
+			return self, self.confirm("delete", fmt.Sprintf("delete %d items permanently?", len(self.trash)), cmd)
 		}
+	case "ctrl+l":
+		return self, listTrashCmd()
+	case "q", "esc", "T":
+		self.currentView = ViewFiles
+	}
+	return self, nil
+}
 
-		// TODO: stuff with symlinks
-		// TODO: paste as symbolic links
-
-	case "p":
-		return self, tea.Sequence(copyFilesCmd(self.selections, self.cwd), refreshFiles(self.cwd))
-
-	case "P":
-		return self, tea.Sequence(moveFilesCmd(self.selections, self.cwd), refreshFiles(self.cwd))
+// run cmd, asking first if the operation needs confirmation
+func (self *model) confirm(op string, text string, cmd tea.Cmd) tea.Cmd {
+	if !self.config.confirm.Contains(op) {
+		return cmd
+	}
+	self.openPrompt(yesNoPrompt(text, cmd))
+	return nil
+}
 
-	case "D":
-		// TODO: prompt before deletion
-		return self, tea.Sequence(deleteFilesCmd(self.selections), refreshFiles(self.cwd))
+// open the prompt, or queue it behind the open one, whose answer could be awaited by a job
+func (self *model) openPrompt(p *prompt) {
+	if self.prompt != nil {
+		self.prompts = append(self.prompts, p)
+		return
+	}
+	if p.kind == PromptInput {
+		p.input.history = self.history[p.history]
+		p.input.histPos = len(p.input.history)
+	}
+	self.prompt = p
+}
 
-	case "h", "left":
-		return self, refreshFiles(filepath.Dir(self.cwd))
+func (self *model) onPromptKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	done, answer, ok := self.prompt.onKey(msg)
+	if !done {
+		if self.prompt.live != nil {
+			return self.update(self.prompt.live(msg.String(), self.prompt.input.String()))
+		}
+		return self, nil
+	}
+	if ok && self.prompt.kind == PromptInput && answer != "" {
+		self.history[self.prompt.history] = append(self.history[self.prompt.history], answer)
+	}
+	// then may open another prompt, which is queued behind the waiting ones
+	then := self.prompt.then
+	self.prompt = nil
+	if len(self.prompts) > 0 {
+		next := self.prompts[0]
+		self.prompts = self.prompts[1:]
+		self.openPrompt(next)
+	}
+	return self, then(answer, ok)
+}
 
-	case "l", "right":
-		return self.open()
+// show the result of an operation on selections. paths that failed stay selected
+func (self *model) finishOp(verb string, done []string, total int, entry journalEntry, err error) (tea.Model, tea.Cmd) {
+	for _, path := range done {
+		self.selections.Remove(path)
+	}
+	if err != nil {
+		self.status = newStatus(fmt.Sprintf("%s %d/%d: %v", verb, len(done), total, err.Error()), true)
+	} else {
+		self.status = newStatus(fmt.Sprintf("%s %d files", verb, len(done)), false)
+	}
+	return self, tea.Batch(clearStatusCmd(self.status.id), refreshFiles(self.cwd), self.record(entry))
+}
 
-	case "o":
-		if self.empty {
-			break
+func (self *model) onKey(key string) (tea.Model, tea.Cmd) {
+	if self.currentView == ViewHelp {
+		switch key {
+		case "j", "down":
+			self.helpOffset = min(self.helpOffset+1, len(self.config.keys.help())-1)
+		case "k", "up":
+			self.helpOffset = max(self.helpOffset-1, 0)
+		default:
+			self.currentView = ViewFiles
+			self.helpOffset = 0
 		}
-		current := self.current()
-		return self, openExternalCmd(self.config.opener, current.Name)
-
-	case ".":
-		self.toggleHidden()
-		return self.refreshPreview()
+		return self, nil
+	}
 
-	case "/":
-		self.toggleDirsonly()
-		return self.refreshPreview()
+	if self.currentView == ViewSelections || self.currentView == ViewErrors {
+		self.currentView = ViewFiles
+		return self, nil
+	}
 
-	case "f":
-		self.togglePreview()
+	if self.currentView == ViewTrash {
+		return self.onTrashKey(key)
+	}
 
-	case "q", "ctrl+c":
-		return self, tea.Quit
+	if self.currentView == ViewJobs {
+		return self.onJobsKey(key)
+	}
 
-	case "?":
-		self.currentView = ViewHelp
+	// keys of a sequence are collected until they make a binding
+	if key == "esc" && len(self.pending) > 0 {
+		self.pending = nil
 		return self, nil
-
-	case " ":
-		self.currentView = ViewSelections
+	}
+	keys := append(self.pending[:len(self.pending):len(self.pending)], key)
+	self.pendingId++
+	if self.config.keys.isPrefix(keys) {
+		self.pending = keys
+		// a sequence that is bound too runs if no more keys come
+		if _, ok := self.config.keys.lookup(keys); ok {
+			return self, keyTimeoutCmd(self.pendingId)
+		}
 		return self, nil
-
-	default:
-		self.status = newStatus(fmt.Sprintf("unmapped key: %s", key), true)
+	}
+	self.pending = nil
+	binding, ok := self.config.keys.lookup(keys)
+	if !ok {
+		self.status = newStatus(fmt.Sprintf("unmapped key: %s", formatKeys(keys)), true)
 		return self, clearStatusCmd(self.status.id)
 	}
-	return self, nil
+	return mustAction(binding.action).run(self, binding.arg)
 }
 
+// the image of the preview is checked after every update, because it changes the view
 func (self model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	return withImage(self.update(msg))
+}
+
+func (self model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if self.prompt != nil {
+			return self.onPromptKey(msg)
+		}
+		if self.currentView == ViewFinder {
+			return self.onFinderKey(msg)
+		}
 		key := msg.String()
 		return self.onKey(key)
 
+	case promptMsg:
+		self.openPrompt(msg.prompt)
+
+	case askMsg:
+		self.openPrompt(msg.prompt)
+		return self, listenCmd(msg.ch)
+
 	case tea.WindowSizeMsg:
 		self.width, self.height = msg.Width, msg.Height
+		// the image is fit to the size of the preview
+		if self.image != nil {
+			return self.refreshPreview()
+		}
 
 	case filesRefreshMsg:
 		if msg.err != nil {
@@ -361,35 +444,132 @@ func (self model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return self, clearStatusCmd(self.status.id)
 		}
 
+		// reloading the same directory keeps the cursor on the same file
+		focus := msg.focus
+		if msg.cwd == self.cwd && !self.empty {
+			if focus == "" {
+				focus = self.current().Name
+			}
+		} else {
+			self.cursor = 0
+			self.topIndex = 0
+		}
+
 		self.cwd = msg.cwd
 		os.Chdir(self.cwd)
 		self.files = msg.files
 		self.sortFiles()
 		self.empty = self.len() == 0
-		self.cursor = 0
-		self.topIndex = 0
+		self.syncCursor()
+		if focus != "" {
+			self.focus(focus)
+		}
+		self.syncBounds()
 		return self.refreshPreview()
 
-	case copyFilesMsg:
+	case bulkRenameEditMsg:
 		if msg.err != nil {
 			self.status = newStatus(msg.err.Error(), true)
 			return self, clearStatusCmd(self.status.id)
 		}
-		self.selections.Clear()
+		return self, editBulkRenameCmd(self.config.editor, msg)
 
-	case moveFilesMsg:
+	case bulkRenameEditedMsg:
+		return self, applyBulkRenameCmd(msg, self.config.confirm.Contains("rename"))
+
+	case bulkRenameMsg:
+		if msg.err != nil && msg.total == 0 {
+			self.status = newStatus(msg.err.Error(), true)
+		} else if msg.err != nil {
+			self.status = newStatus(fmt.Sprintf("renamed %d/%d: %v", msg.renamed, msg.total, msg.err.Error()), true)
+		} else {
+			self.status = newStatus(fmt.Sprintf("renamed %d files", msg.renamed), false)
+		}
+		return self, tea.Batch(clearStatusCmd(self.status.id), refreshFiles(self.cwd), self.record(msg.entry))
+
+	case journalLoadedMsg:
+		return self, self.onJournalLoaded(msg)
+
+	case journalSavedMsg:
+		if msg.err != nil {
+			self.status = newStatus(fmt.Sprintf("saving journal: %v", msg.err), true)
+			return self, clearStatusCmd(self.status.id)
+		}
+
+	case journalMsg:
+		return self, self.onJournal(msg)
+
+	case renameFileMsg:
+		if msg.err != nil {
+			self.status = newStatus(msg.err.Error(), true)
+			return self, clearStatusCmd(self.status.id)
+		}
+		return self, tea.Batch(refreshFilesFocus(self.cwd, msg.focus), self.record(msg.entry))
+
+	case createFileMsg:
 		if msg.err != nil {
 			self.status = newStatus(msg.err.Error(), true)
 			return self, clearStatusCmd(self.status.id)
 		}
+		return self, tea.Batch(refreshFilesFocus(self.cwd, msg.focus), self.record(msg.entry))
+
+	case jobStartedMsg:
+		self.onJobStarted(msg)
+		return self, listenCmd(msg.ch)
+
+	case progressMsg:
+		if job := self.job(msg.id); job != nil {
+			job.progress = msg
+		}
+		self.status = newStatus(msg.String(), false)
+		return self, listenCmd(msg.ch)
+
+	case jobDoneMsg:
+		self.onJobDone(msg)
+		return self.update(msg.msg)
+
+	case copyFilesMsg:
+		if msg.err != nil {
+			self.status = newStatus(msg.err.Error(), true)
+			return self, tea.Batch(clearStatusCmd(self.status.id), refreshFiles(self.cwd), self.record(msg.entry))
+		}
 		self.selections.Clear()
+		self.status = newStatus("copied", false)
+		return self, tea.Batch(clearStatusCmd(self.status.id), refreshFiles(self.cwd), self.record(msg.entry))
+
+	case linkFilesMsg:
+		if msg.err != nil {
+			self.status = newStatus(msg.err.Error(), true)
+			return self, tea.Batch(clearStatusCmd(self.status.id), refreshFiles(self.cwd), self.record(msg.entry))
+		}
+		self.selections.Clear()
+		self.status = newStatus(fmt.Sprintf("linked %d files", len(msg.entry.Created)), false)
+		return self, tea.Batch(clearStatusCmd(self.status.id), refreshFiles(self.cwd), self.record(msg.entry))
+
+	case moveFilesMsg:
+		return self.finishOp("moved", msg.moved, msg.total, msg.entry, msg.err)
+
+	case trashFilesMsg:
+		return self.finishOp("trashed", msg.trashed, msg.total, trashEntry(msg.items), msg.err)
 
 	case deleteFilesMsg:
+		return self.finishOp("deleted", msg.deleted, msg.total, journalEntry{}, msg.err)
+
+	case trashListMsg:
+		self.trash = msg.items
+		self.trashCursor = max(min(self.trashCursor, len(self.trash)-1), 0)
 		if msg.err != nil {
 			self.status = newStatus(msg.err.Error(), true)
 			return self, clearStatusCmd(self.status.id)
 		}
-		self.selections.Clear()
+
+	case trashChangedMsg:
+		if msg.err != nil {
+			self.status = newStatus(msg.err.Error(), true)
+		} else {
+			self.status = newStatus(msg.text, false)
+		}
+		return self, tea.Batch(clearStatusCmd(self.status.id), listTrashCmd(), refreshFiles(self.cwd))
 
 	case clearStatusMsg:
 		if self.status.id == msg.id {
@@ -397,11 +577,53 @@ func (self model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return self, nil
 
+	case keyTimeoutMsg:
+		if msg.id != self.pendingId || len(self.pending) == 0 {
+			return self, nil
+		}
+		binding, ok := self.config.keys.lookup(self.pending)
+		self.pending = nil
+		if !ok {
+			return self, nil
+		}
+		return mustAction(binding.action).run(&self, binding.arg)
+
 	case processFininishedMsg:
 		if msg.err != nil {
 			self.status = newStatus(fmt.Sprintf("process finished: %v", msg.err.Error()), true)
-			return self, clearStatusCmd(self.status.id)
+			return self, tea.Batch(clearStatusCmd(self.status.id), refreshFiles(self.cwd))
 		}
+		// the process could have changed files
+		return self, refreshFiles(self.cwd)
+
+	case filterMsg:
+		return self.onFilter(msg)
+
+	case searchMsg:
+		return self.onSearch(msg)
+
+	case reloadConfigMsg:
+		return self, loadConfigCmd(self.configPath)
+
+	case configLoadedMsg:
+		return self.onConfigLoaded(msg)
+
+	case configTickMsg:
+		return self.onConfigTick(msg)
+
+	case sortMsg:
+		self.sortby(msg.sort)
+		model, cmd := self.refreshPreview()
+		return model, tea.Batch(cmd, clearStatusCmd(self.status.id))
+
+	case finderFoundMsg:
+		return self.onFinderFound(msg)
+
+	case finderDoneMsg:
+		return self.onFinderDone(msg)
+
+	case finderRankedMsg:
+		return self.onFinderRanked(msg)
 
 	case previewMsg:
 		if msg.err != nil {
@@ -410,13 +632,19 @@ func (self model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		if !self.empty && msg.path == self.current().Path {
 			self.preview = msg.lines
+			self.image = msg.image
 		}
+
 	}
 	return self, nil
 }
 
 func (self model) Init() tea.Cmd {
-	return refreshFiles(self.cwd)
+	cmds := []tea.Cmd{refreshFiles(self.cwd), loadJournalCmd()}
+	if self.watching {
+		cmds = append(cmds, watchConfigCmd(self.configPath))
+	}
+	return tea.Batch(cmds...)
 }
 
 func newModel(cwd string, config config) model {
@@ -432,6 +660,26 @@ func newModel(cwd string, config config) model {
 		bookmarks:   defaultBookmarks(),
 		currentView: ViewFiles,
 		config:      config,
+		sourced:     config,
+		watching:    config.autoreload,
 		status:      status{},
+		history:     make(map[string][]string),
+		filters:     make(map[string]fileFilter),
+	}
+}
+
+// keep the errors for the errors view, and tell about them in the status line
+func (self *model) reportConfigErrors(errs []error) {
+	self.configErrors = errs
+	if len(errs) == 0 {
+		return
+	}
+	text := errs[0].Error()
+	if len(errs) > 1 {
+		text += fmt.Sprintf(" (and %d more)", len(errs)-1)
+	}
+	if keys, ok := self.config.keys.keysOf("errors-view"); ok {
+		text += fmt.Sprintf(", %v to show all", keys)
 	}
+	self.status = newStatus(text, true)
 }
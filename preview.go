@@ -1,9 +1,13 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strings"
+	"unicode/utf8"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -11,47 +15,168 @@ import (
 type previewMsg struct {
 	path  string
 	lines []string
+	image *terminalImage // drawn over the lines
 	err   error
 }
 
-// TODO: binary files, syntax highlighting, images, ...
-func previewCmd(path string) tea.Cmd {
-	return func() tea.Msg {
-		height := 100
+type previewOptions struct {
+	style  string // of syntax highlighting
+	images ImageProtocol
+	width  int // of the preview pane, in cells
+	height int
+}
 
-		var lines []string
+const (
+	previewHeight = 100
+	previewBytes  = 64 * 1024 // read from the beginning of text files
+	hexdumpBytes  = 4 * 1024
+	tabWidth      = 8
+)
 
+func previewCmd(path string, options previewOptions) tea.Cmd {
+	return func() tea.Msg {
 		info, err := os.Stat(path)
 		if err != nil {
-			return previewMsg{err: err}
+			return previewMsg{path: path, err: err}
 		}
 		if info.IsDir() {
-			lines = append(lines, fmt.Sprintf("directory %v:", path))
+			lines, err := previewDir(path)
+			return previewMsg{path: path, lines: lines, err: err}
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return previewMsg{path: path, err: err}
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, previewBytes))
+		if err != nil {
+			return previewMsg{path: path, err: err}
+		}
 
-			files, err := os.ReadDir(path)
-			if err != nil {
-				return previewMsg{err: err}
+		contentType := http.DetectContentType(data)
+		if strings.HasPrefix(contentType, "image/") && options.images != ImageNone {
+			// formats that cannot be decoded are previewed like other binaries
+			lines, image, err := previewImage(path, options.images, options.width, options.height)
+			if err == nil {
+				return previewMsg{path: path, lines: lines, image: image}
 			}
-			for i, file := range files {
-				if i > height {
-					break
-				}
-				lines = append(lines, file.Name())
+		}
+		if isBinary(data, contentType) {
+			lines := []string{fmt.Sprintf("binary file, %v, %v", contentType, humanSize(info.Size()))}
+			lines = append(lines, hexdump(data[:min(len(data), hexdumpBytes)])...)
+			return previewMsg{path: path, lines: lines}
+		}
+		return previewMsg{path: path, lines: highlight(path, previewText(data), options.style)}
+	}
+}
+
+func previewDir(path string) ([]string, error) {
+	lines := []string{fmt.Sprintf("directory %v:", path)}
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range files {
+		if i >= previewHeight {
+			break
+		}
+		lines = append(lines, sanitize(file.Name()))
+	}
+	return lines, nil
+}
+
+// a file is binary if it has NUL bytes, is not UTF-8 or is sniffed as something else than text
+func isBinary(data []byte, contentType string) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	if !validUTF8(data) {
+		return true
+	}
+	return !strings.HasPrefix(contentType, "text/")
+}
+
+// like utf8.Valid, but data can end in the middle of a rune, where the read stopped
+func validUTF8(data []byte) bool {
+	for i := 1; i <= min(utf8.UTFMax-1, len(data)); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				data = data[:len(data)-i]
 			}
+			break
 		}
+	}
+	return utf8.Valid(data)
+}
 
-		file, err := os.Open(path)
-		if err != nil {
-			return previewMsg{err: err}
+func previewText(data []byte) []string {
+	var lines []string
+	text := strings.TrimSuffix(string(data), "\n")
+	for _, line := range strings.SplitN(text, "\n", previewHeight+1) {
+		if len(lines) == previewHeight {
+			break
 		}
+		lines = append(lines, sanitize(strings.TrimSuffix(line, "\r")))
+	}
+	return lines
+}
 
-		scanner := bufio.NewScanner(file)
-		scanner.Split(bufio.ScanLines)
-		for i := 0; scanner.Scan() && i < height; i++ {
-			l := scanner.Text()
-			lines = append(lines, l)
+// expand tabs and show control characters like cat -v, so that they do not reach the terminal
+func sanitize(line string) string {
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		switch {
+		case r == '\t':
+			n := tabWidth - col%tabWidth
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		case r < 0x20:
+			b.WriteByte('^')
+			b.WriteRune(r + '@')
+			col++
+		case r == 0x7f:
+			b.WriteString("^?")
+			col++
+		case r >= 0x80 && r < 0xa0, r == utf8.RuneError:
+			b.WriteRune('?')
+		default:
+			b.WriteRune(r)
 		}
+		col++
+	}
+	return b.String()
+}
 
-		return previewMsg{path, lines, err}
+// lines like xxd: offset, 16 bytes in groups of 2, and the printable ones
+func hexdump(data []byte) []string {
+	var lines []string
+	for offset := 0; offset < len(data); offset += 16 {
+		row := data[offset:min(offset+16, len(data))]
+		var line strings.Builder
+		fmt.Fprintf(&line, "%08x: ", offset)
+		for i := 0; i < 16; i++ {
+			if i < len(row) {
+				fmt.Fprintf(&line, "%02x", row[i])
+			} else {
+				line.WriteString("  ")
+			}
+			if i%2 == 1 {
+				line.WriteByte(' ')
+			}
+		}
+		line.WriteByte(' ')
+		for _, c := range row {
+			if c >= 0x20 && c < 0x7f {
+				line.WriteByte(c)
+			} else {
+				line.WriteByte('.')
+			}
+		}
+		lines = append(lines, line.String())
 	}
+	return lines
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a\tb", "a       b"},
+		{"\tx", "        x"},
+		{"12345678\tx", "12345678        x"},
+		{"é\tx", "é       x"},
+		{"\x01\x1b[31m", "^A^[[31m"},
+		{"a\x7fb", "a^?b"},
+		{"^A\t.", "^A      ."},
+		{"\x00\t.", "^@      ."},
+		{"\u0085\u009b", "??"},
+		{"a\xffb", "a?b"},
+	}
+	for _, test := range tests {
+		if got := sanitize(test.line); got != test.want {
+			t.Errorf("sanitize(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestHexdump(t *testing.T) {
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"", nil},
+		{"hello", []string{"00000000: 6865 6c6c 6f" + strings.Repeat(" ", 29) + "hello"}},
+		{"0123456789abcdef\x00\n~\x7f", []string{
+			"00000000: 3031 3233 3435 3637 3839 6162 6364 6566  0123456789abcdef",
+			"00000010: 000a 7e7f" + strings.Repeat(" ", 32) + "..~.",
+		}},
+	}
+	for _, test := range tests {
+		if got := hexdump([]byte(test.data)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("hexdump(%q) = %q, want %q", test.data, got, test.want)
+		}
+	}
+}
+
+func TestValidUTF8(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"", true},
+		{"ascii", true},
+		{"café", true},
+		{"caf\xc3", true},      // é cut by the read
+		{"\xf0\x9f\x98", true}, // 😀 cut after 3 bytes
+		{"\xf0\x9f\x98\x80", true},
+		{"\xff", false},
+		{"a\xffb", false},
+		{"\xc3\xa9\xa9", false}, // a continuation byte too many
+		{"\xc3x", false},        // a cut rune that is not at the end
+	}
+	for _, test := range tests {
+		if got := validUTF8([]byte(test.data)); got != test.want {
+			t.Errorf("validUTF8(%q) = %v, want %v", test.data, got, test.want)
+		}
+	}
+}
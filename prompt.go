@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type promptKind byte
+
+const (
+	PromptYesNo promptKind = iota
+	PromptInput
+	PromptChoice
+)
+
+type choice struct {
+	key  string
+	text string
+}
+
+// a modal question in the status line. while it is open, it gets all keys
+type prompt struct {
+	kind    promptKind
+	text    string
+	choices []choice
+	input   lineEditor
+	history string // name of the input history
+	// called with the answer when the prompt is closed; ok is false if it was cancelled
+	then func(answer string, ok bool) tea.Cmd
+	// if set, called after every key that does not close an input prompt; the msg is handled right away
+	live func(key string, value string) tea.Msg
+}
+
+// opens the prompt from a command
+type promptMsg struct {
+	prompt *prompt
+}
+
+func openPromptCmd(p *prompt) tea.Cmd {
+	return func() tea.Msg {
+		return promptMsg{p}
+	}
+}
+
+// runs cmd if the answer is yes
+func yesNoPrompt(text string, cmd tea.Cmd) *prompt {
+	return &prompt{
+		kind: PromptYesNo,
+		text: text,
+		then: func(answer string, ok bool) tea.Cmd {
+			if ok {
+				return cmd
+			}
+			return nil
+		},
+	}
+}
+
+func inputPrompt(history string, text string, initial string, then func(answer string) tea.Cmd) *prompt {
+	return &prompt{
+		kind:    PromptInput,
+		text:    text,
+		input:   newLineEditor(initial, nil),
+		history: history,
+		then: func(answer string, ok bool) tea.Cmd {
+			if ok {
+				return then(answer)
+			}
+			return nil
+		},
+	}
+}
+
+func choicePrompt(text string, choices []choice, then func(key string, ok bool) tea.Cmd) *prompt {
+	return &prompt{
+		kind:    PromptChoice,
+		text:    text,
+		choices: choices,
+		then:    then,
+	}
+}
+
+// feed a key to the prompt. returns true and the answer when it is closed
+func (self *prompt) onKey(msg tea.KeyMsg) (done bool, answer string, ok bool) {
+	key := msg.String()
+	if key == "esc" || key == "ctrl+c" {
+		return true, "", false
+	}
+	switch self.kind {
+	case PromptYesNo:
+		switch key {
+		case "y", "Y":
+			return true, "y", true
+		case "n", "N", "enter":
+			return true, "n", false
+		}
+
+	case PromptChoice:
+		// answered with the key as typed, so that callers can tell "o" from "O"
+		for _, choice := range self.choices {
+			if strings.ToLower(key) == choice.key {
+				return true, key, true
+			}
+		}
+
+	case PromptInput:
+		if msg.Type == tea.KeyEnter {
+			return true, self.input.String(), true
+		}
+		self.input.onKey(msg)
+	}
+	return false, "", false
+}
+
+func (self *prompt) String() string {
+	switch self.kind {
+	case PromptYesNo:
+		return fmt.Sprintf("%s [y/N]", self.text)
+	case PromptChoice:
+		var choices []string
+		for _, choice := range self.choices {
+			choices = append(choices, fmt.Sprintf("%s:%s", choice.key, choice.text))
+		}
+		return fmt.Sprintf("%s %s", self.text, strings.Join(choices, " "))
+	default:
+		return fmt.Sprintf("%s%s", self.text, self.input.String())
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// how often the config file is checked for changes with autoreload
+const watchInterval = time.Second
+
+// asks to source the config again
+type reloadConfigMsg struct{}
+
+type configLoadedMsg struct {
+	config   config
+	errs     []error
+	modified time.Time
+	err      error // the file could not be read; nothing was loaded
+}
+
+// modification time of the config file, zero if it does not exist
+type configTickMsg struct {
+	modified time.Time
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// source the config into a fresh config, so that removed lines go back to their defaults
+func loadConfigCmd(path string) tea.Cmd {
+	return func() tea.Msg {
+		var msg configLoadedMsg
+		info, err := os.Stat(path)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		msg.modified = info.ModTime()
+		msg.config = initConfig()
+		msg.errs = msg.config.source(path)
+		return msg
+	}
+}
+
+// files that the config sources are not watched
+func watchConfigCmd(path string) tea.Cmd {
+	return tea.Tick(watchInterval, func(t time.Time) tea.Msg {
+		return configTickMsg{modTime(path)}
+	})
+}
+
+func (self *model) onConfigTick(msg configTickMsg) (tea.Model, tea.Cmd) {
+	if !self.config.autoreload {
+		self.watching = false
+		return self, nil
+	}
+	cmd := watchConfigCmd(self.configPath)
+	if !msg.modified.IsZero() && !msg.modified.Equal(self.configModified) {
+		// not reloaded again by the next tick while this one is loading
+		self.configModified = msg.modified
+		cmd = tea.Batch(cmd, loadConfigCmd(self.configPath))
+	}
+	return self, cmd
+}
+
+// apply the new config. cursor, selections and bookmarks are kept
+func (self *model) onConfigLoaded(msg configLoadedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		text := fmt.Sprintf("cannot reload config: %v", msg.err)
+		if errors.Is(msg.err, os.ErrNotExist) {
+			text = fmt.Sprintf("cannot reload config: %v does not exist", withTilde(self.configPath))
+		}
+		self.status = newStatus(text, true)
+		return self, clearStatusCmd(self.status.id)
+	}
+
+	// settings that are toggled at runtime stay as they are, unless the file changes them
+	next := msg.config
+	if next.showhidden == self.sourced.showhidden {
+		next.showhidden = self.config.showhidden
+	}
+	if next.dirsonly == self.sourced.dirsonly {
+		next.dirsonly = self.config.dirsonly
+	}
+	if next.preview == self.sourced.preview {
+		next.preview = self.config.preview
+	}
+	if next.sort == self.sourced.sort {
+		next.sort = self.config.sort
+	}
+
+	var name string
+	if !self.empty {
+		name = self.current().Name
+	}
+	self.config = next
+	self.sourced = msg.config
+	self.configModified = msg.modified
+	self.pending = nil
+
+	self.sortFiles()
+	self.empty = self.len() == 0
+	self.syncCursor()
+	self.focus(name)
+	self.syncBounds()
+
+	var cmds []tea.Cmd
+	if self.config.autoreload && !self.watching {
+		self.watching = true
+		cmds = append(cmds, watchConfigCmd(self.configPath))
+	}
+	self.reportConfigErrors(msg.errs)
+	if len(msg.errs) == 0 {
+		self.status = newStatus("config reloaded", false)
+		cmds = append(cmds, clearStatusCmd(self.status.id))
+	}
+	model, cmd := self.refreshPreview()
+	return model, tea.Batch(append(cmds, cmd)...)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	tea "github.com/charmbracelet/bubbletea"
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+// vim-like search: the cursor jumps to matching names, all files stay visible
+
+// the search pattern was changed. the cursor moves to the first match at or after from
+type searchMsg struct {
+	pattern string
+	from    int
+	done    bool // the prompt was closed
+}
+
+// smart case substring match
+func searchRegexp(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	expr := regexp.QuoteMeta(pattern)
+	if !caseSensitive(pattern) {
+		expr = "(?i)" + expr
+	}
+	return regexp.MustCompile(expr)
+}
+
+// index of the next matching visible file in the direction, wrapping around; -1 if none
+func (self *model) findMatch(from int, direction int) int {
+	re := self.matcher
+	files := self.visibleFiles()
+	if re == nil || len(files) == 0 {
+		return -1
+	}
+	for i := 0; i < len(files); i++ {
+		j := modulo(from+i*direction, len(files))
+		if re.MatchString(files[j].Name) {
+			return j
+		}
+	}
+	return -1
+}
+
+// open the search prompt. the cursor follows the pattern as it is typed;
+// esc brings back the cursor and the previous pattern
+func (self *model) openSearch() {
+	from := self.cursor
+	previous := self.search
+	p := inputPrompt("search", "/", "", func(answer string) tea.Cmd {
+		return func() tea.Msg {
+			return searchMsg{answer, from, true}
+		}
+	})
+	then := p.then
+	p.then = func(answer string, ok bool) tea.Cmd {
+		if !ok {
+			return func() tea.Msg {
+				return searchMsg{previous, from, true}
+			}
+		}
+		return then(answer, ok)
+	}
+	p.live = func(key string, value string) tea.Msg {
+		return searchMsg{value, from, false}
+	}
+	self.openPrompt(p)
+}
+
+func (self *model) onSearch(msg searchMsg) (tea.Model, tea.Cmd) {
+	self.search = msg.pattern
+	self.matcher = searchRegexp(msg.pattern)
+	self.cursor = msg.from
+	if i := self.findMatch(msg.from, 1); i >= 0 {
+		self.cursor = i
+	} else if msg.done && msg.pattern != "" {
+		self.status = newStatus(fmt.Sprintf("pattern not found: %v", msg.pattern), true)
+		self.syncCursor()
+		self.syncBounds()
+		model, cmd := self.refreshPreview()
+		return model, tea.Batch(cmd, clearStatusCmd(self.status.id))
+	}
+	self.syncCursor()
+	self.syncBounds()
+	return self.refreshPreview()
+}
+
+// jump to the next match in the direction
+func (self *model) searchNext(direction int) (tea.Model, tea.Cmd) {
+	if self.search == "" {
+		self.status = newStatus("no previous search pattern", true)
+		return self, clearStatusCmd(self.status.id)
+	}
+	i := self.findMatch(self.cursor+direction, direction)
+	if i < 0 {
+		self.status = newStatus(fmt.Sprintf("pattern not found: %v", self.search), true)
+		return self, clearStatusCmd(self.status.id)
+	}
+	self.cursor = i
+	self.syncBounds()
+	return self.refreshPreview()
+}
+
+// render name with matches of the search pattern highlighted
+func (self *model) highlightSearch(name string, style lipgloss.Style) string {
+	re := self.matcher
+	if re == nil {
+		return style.Render(name)
+	}
+	styleMatch := self.config.theme.apply("match", style.Copy())
+	var view string
+	last := 0
+	for _, match := range re.FindAllStringIndex(name, -1) {
+		view += style.Render(name[last:match[0]]) + styleMatch.Render(name[match[0]:match[1]])
+		last = match[1]
+	}
+	return view + style.Render(name[last:])
+}
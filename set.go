@@ -38,3 +38,11 @@ func (self set[T]) Superset(other []T) bool {
 func (self set[T]) Clear() {
 	clear(self)
 }
+
+func (self set[T]) Values() []T {
+	values := make([]T, 0, len(self))
+	for v := range self {
+		values = append(values, v)
+	}
+	return values
+}
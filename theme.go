@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+// colors of ui elements. lipgloss degrades them to what the terminal supports;
+// built-in themes also give the exact 16-color fallbacks
+
+type themeColor struct {
+	fg, bg lipgloss.TerminalColor // nil is the terminal default
+}
+
+type theme map[string]themeColor
+
+// elements that can be colored
+var themeElements = set[string]{
+	"dir":       {}, // directory names
+	"file":      {}, // other file names
+	"link":      {}, // symlink names
+	"broken":    {}, // broken symlink names
+	"cursor":    {}, // line under the cursor
+	"selection": {}, // selected file names
+	"mode":      {},
+	"mtime":     {},
+	"path":      {}, // directory in the top line
+	"current":   {}, // file name in the top line
+	"info":      {}, // secondary text: link targets, job counts, dates
+	"filter":    {}, // filter indicator
+	"match":     {}, // matches of search and finder
+	"error":     {}, // status line errors
+	"preview":   {},
+	"border":    {},
+}
+
+// truecolor, 256 and 16 color versions of a color
+func adaptive(hex, ansi256, ansi string) lipgloss.TerminalColor {
+	return lipgloss.CompleteColor{TrueColor: hex, ANSI256: ansi256, ANSI: ansi}
+}
+
+func darkTheme() theme {
+	return theme{
+		"dir":     {fg: adaptive("#3071ff", "27", "12")},
+		"file":    {fg: adaptive("#ffffff", "15", "15")},
+		"link":    {fg: adaptive("#2ee5f5", "51", "14")},
+		"broken":  {fg: adaptive("#ff5f5f", "203", "9")},
+		"cursor":  {bg: adaptive("#616161", "241", "8")},
+		"mode":    {fg: adaptive("#ffd35e", "221", "11")},
+		"mtime":   {fg: adaptive("#bbbbbb", "250", "7")},
+		"path":    {fg: adaptive("#006cb6", "25", "4")},
+		"current": {fg: adaptive("#daf52e", "191", "11")},
+		"info":    {fg: adaptive("#bbbbbb", "250", "7")},
+		"filter":  {fg: adaptive("#ffd35e", "221", "11")},
+		"match":   {fg: adaptive("#000000", "16", "0"), bg: adaptive("#ffd35e", "221", "11")},
+		"error":   {fg: adaptive("#ff0000", "196", "9")},
+		"preview": {fg: adaptive("#afafaf", "145", "7")},
+		"border":  {fg: adaptive("#18ff20", "46", "10")},
+	}
+}
+
+func lightTheme() theme {
+	return theme{
+		"dir":     {fg: adaptive("#0040c0", "19", "4")},
+		"file":    {fg: adaptive("#000000", "16", "0")},
+		"link":    {fg: adaptive("#007a7a", "30", "6")},
+		"broken":  {fg: adaptive("#c00000", "124", "1")},
+		"cursor":  {bg: adaptive("#d0d0d0", "252", "7")},
+		"mode":    {fg: adaptive("#8a6d00", "136", "3")},
+		"mtime":   {fg: adaptive("#606060", "241", "8")},
+		"path":    {fg: adaptive("#004d80", "24", "4")},
+		"current": {fg: adaptive("#6b7a00", "100", "2")},
+		"info":    {fg: adaptive("#606060", "241", "8")},
+		"filter":  {fg: adaptive("#8a6d00", "136", "3")},
+		"match":   {fg: adaptive("#000000", "16", "0"), bg: adaptive("#ffd35e", "221", "11")},
+		"error":   {fg: adaptive("#c00000", "124", "1")},
+		"preview": {fg: adaptive("#404040", "238", "8")},
+		"border":  {fg: adaptive("#008000", "28", "2")},
+	}
+}
+
+var colorNames = map[string]string{
+	"black": "0", "red": "1", "green": "2", "yellow": "3",
+	"blue": "4", "magenta": "5", "cyan": "6", "white": "7",
+	"brightblack": "8", "brightred": "9", "brightgreen": "10", "brightyellow": "11",
+	"brightblue": "12", "brightmagenta": "13", "brightcyan": "14", "brightwhite": "15",
+}
+
+// #rgb, #rrggbb, an ansi color number, a color name, or none for the terminal default
+func parseColor(s string) (lipgloss.TerminalColor, error) {
+	s = strings.ToLower(s)
+	if s == "none" || s == "default" {
+		return nil, nil
+	}
+	if name, ok := colorNames[s]; ok {
+		return lipgloss.Color(name), nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 255 {
+			return nil, fmt.Errorf("color number out of range: %v", s)
+		}
+		return lipgloss.Color(s), nil
+	}
+	if strings.HasPrefix(s, "#") && (len(s) == 4 || len(s) == 7) {
+		if _, err := strconv.ParseUint(s[1:], 16, 32); err == nil {
+			return lipgloss.Color(s), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid color %v", s)
+}
+
+// set the colors of an element from "color <element> <fg> [bg]" arguments
+func (self theme) set(args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf("expected <element> <fg> [bg]")
+	}
+	if !themeElements.Contains(args[0]) {
+		return fmt.Errorf("unknown element %v", args[0])
+	}
+	var c themeColor
+	var err error
+	if c.fg, err = parseColor(args[1]); err != nil {
+		return err
+	}
+	if len(args) == 3 {
+		if c.bg, err = parseColor(args[2]); err != nil {
+			return err
+		}
+	}
+	self[args[0]] = c
+	return nil
+}
+
+func builtinTheme(name string) (theme, bool) {
+	switch name {
+	case "dark":
+		return darkTheme(), true
+	case "light":
+		return lightTheme(), true
+	case "auto":
+		if lipgloss.HasDarkBackground() {
+			return darkTheme(), true
+		}
+		return lightTheme(), true
+	}
+	return nil, false
+}
+
+// a built-in theme, or a file of color lines on top of the dark theme or of the one that
+// a "base" line names before them
+func loadTheme(name string) (theme, error) {
+	if t, ok := builtinTheme(name); ok {
+		return t, nil
+	}
+	path := expandHome(name)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	commands, errs := lexConfig(path, string(content))
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	t := darkTheme()
+	colored := false
+	for _, command := range commands {
+		at := command[0]
+		if at.text == "base" {
+			if colored {
+				return nil, configError{path, at.line, at.col, "base must come before color lines"}
+			}
+			base, ok := theme(nil), false
+			if len(command) == 2 {
+				base, ok = builtinTheme(command[1].text)
+			}
+			if !ok {
+				return nil, configError{path, at.line, at.col, "expected base dark|light|auto"}
+			}
+			t = base
+			continue
+		}
+		if at.text != "color" {
+			return nil, configError{path, command[0].line, command[0].col, "expected color <element> <fg> [bg]"}
+		}
+		colored = true
+		if err := t.set(argsOf(command[1:])); err != nil {
+			return nil, configError{path, command[0].line, command[0].col, err.Error()}
+		}
+	}
+	return t, nil
+}
+
+// base with the colors of the element
+func (self theme) apply(element string, base lipgloss.Style) lipgloss.Style {
+	c := self[element]
+	if c.fg != nil {
+		base = base.Foreground(c.fg)
+	}
+	if c.bg != nil {
+		base = base.Background(c.bg)
+	}
+	return base
+}
+
+func (self theme) style(element string) lipgloss.Style {
+	return self.apply(element, lipgloss.NewStyle())
+}
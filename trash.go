@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// FreeDesktop.org trash, see https://specifications.freedesktop.org/trash-spec/trashspec-latest.html
+
+const trashInfoTime = "2006-01-02T15:04:05"
+
+type trashItem struct {
+	Name     string    `json:"name"`     // name in the files directory of the trash
+	Trash    string    `json:"trash"`    // trash directory that contains files/ and info/
+	Original string    `json:"original"` // absolute path before deletion
+	Deleted  time.Time `json:"deleted"`
+}
+
+func (self trashItem) filesPath() string {
+	return filepath.Join(self.Trash, "files", self.Name)
+}
+
+func (self trashItem) infoPath() string {
+	return filepath.Join(self.Trash, "info", self.Name+".trashinfo")
+}
+
+func homeTrash() string {
+	return filepath.Join(envOr("XDG_DATA_HOME", expandHome("~/.local/share")), "Trash")
+}
+
+func deviceOf(path string) (uint64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("%v: no device information", path)
+	}
+	return uint64(stat.Dev), nil
+}
+
+// mount point of the filesystem that contains path
+func topdir(path string) (string, error) {
+	dev, err := deviceOf(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, nil
+		}
+		parentDev, err := deviceOf(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentDev != dev {
+			return path, nil
+		}
+		path = parent
+	}
+}
+
+// the trash that path should be moved to, created if necessary
+func trashDirFor(path string) (string, error) {
+	home := homeTrash()
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return "", err
+	}
+	homeDev, err := deviceOf(home)
+	if err != nil {
+		return "", err
+	}
+	dev, err := deviceOf(path)
+	if err != nil {
+		return "", err
+	}
+	if dev == homeDev {
+		return home, nil
+	}
+
+	top, err := topdir(path)
+	if err != nil {
+		return "", err
+	}
+	uid := strconv.Itoa(os.Getuid())
+	// administrator created $topdir/.Trash must be a sticky directory and not a symlink
+	if info, err := os.Lstat(filepath.Join(top, ".Trash")); err == nil && info.IsDir() && info.Mode()&fs.ModeSticky != 0 {
+		dir := filepath.Join(top, ".Trash", uid)
+		if err := os.MkdirAll(dir, 0700); err == nil {
+			return dir, nil
+		}
+	}
+	dir := filepath.Join(top, ".Trash-"+uid)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("%v: no trash on this device: %w", path, err)
+	}
+	return dir, nil
+}
+
+// move path to the trash
+func trashPath(path string) (item trashItem, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	item.Trash, err = trashDirFor(path)
+	if err != nil {
+		return
+	}
+	for _, dir := range []string{"files", "info"} {
+		if err = os.MkdirAll(filepath.Join(item.Trash, dir), 0700); err != nil {
+			return
+		}
+	}
+	item.Original = path
+	item.Deleted = time.Now()
+
+	// the info file is created exclusively to reserve the name
+	base := filepath.Base(path)
+	var info *os.File
+	for i := 1; ; i++ {
+		item.Name = base
+		if i > 1 {
+			item.Name = fmt.Sprintf("%s.%d", base, i)
+		}
+		info, err = os.OpenFile(item.infoPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		break
+	}
+	err = item.writeInfo(info)
+	if closeErr := info.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path, item.filesPath())
+	}
+	if err != nil {
+		os.Remove(item.infoPath())
+	}
+	return
+}
+
+func (self trashItem) writeInfo(w io.Writer) error {
+	escaped := (&url.URL{Path: self.Original}).EscapedPath()
+	_, err := fmt.Fprintf(w, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, self.Deleted.Format(trashInfoTime))
+	return err
+}
+
+func parseTrashInfo(trash, infoPath string) (item trashItem, err error) {
+	file, err := os.Open(infoPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	item.Trash = trash
+	item.Name = strings.TrimSuffix(filepath.Base(infoPath), ".trashinfo")
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			item.Original, err = url.PathUnescape(value)
+			if err != nil {
+				return
+			}
+			// relative to the topdir of the trash
+			if !filepath.IsAbs(item.Original) {
+				top := filepath.Dir(trash)
+				if filepath.Base(top) == ".Trash" {
+					top = filepath.Dir(top)
+				}
+				item.Original = filepath.Join(top, item.Original)
+			}
+		case "DeletionDate":
+			item.Deleted, _ = time.ParseInLocation(trashInfoTime, value, time.Local)
+		}
+	}
+	if item.Original == "" {
+		err = fmt.Errorf("%v: no Path in trash info", infoPath)
+	}
+	return
+}
+
+// mount points from /proc/self/mounts
+func mountPoints() (mounts []string) {
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		// spaces and such are octal escapes, e.g. \040
+		mount := fields[1]
+		for i := strings.Index(mount, "\\"); i >= 0 && i+4 <= len(mount); i = strings.Index(mount, "\\") {
+			c, err := strconv.ParseUint(mount[i+1:i+4], 8, 8)
+			if err != nil {
+				break
+			}
+			mount = mount[:i] + string(rune(c)) + mount[i+4:]
+		}
+		mounts = append(mounts, mount)
+	}
+	return
+}
+
+// home trash and per-mount trashes that exist
+func trashDirs() []string {
+	dirs := []string{homeTrash()}
+	// the same filesystem can be mounted more than once
+	seen := set[string]{}
+	seen.Add(dirs[0])
+	uid := strconv.Itoa(os.Getuid())
+	for _, mount := range mountPoints() {
+		for _, dir := range []string{filepath.Join(mount, ".Trash", uid), filepath.Join(mount, ".Trash-"+uid)} {
+			if seen.Contains(dir) {
+				continue
+			}
+			seen.Add(dir)
+			if info, err := os.Stat(filepath.Join(dir, "info")); err == nil && info.IsDir() {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// items in all trashes, most recently deleted first
+func listTrash() (items []trashItem, err error) {
+	var errs []error
+	for _, trash := range trashDirs() {
+		infos, err := filepath.Glob(filepath.Join(trash, "info", "*.trashinfo"))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, info := range infos {
+			item, err := parseTrashInfo(trash, info)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Deleted.After(items[j].Deleted)
+	})
+	return items, errors.Join(errs...)
+}
+
+// move the item back to its original path
+func (self trashItem) restore() error {
+	if _, err := os.Lstat(self.Original); err == nil {
+		return fmt.Errorf("%v: already exists", self.Original)
+	}
+	if err := os.MkdirAll(filepath.Dir(self.Original), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(self.filesPath(), self.Original); err != nil {
+		return err
+	}
+	return os.Remove(self.infoPath())
+}
+
+// move a restored item back to where it was in the trash
+func (self trashItem) putBack() error {
+	info, err := os.OpenFile(self.infoPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = self.writeInfo(info)
+	if closeErr := info.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(self.Original, self.filesPath())
+	}
+	if err != nil {
+		os.Remove(self.infoPath())
+	}
+	return err
+}
+
+// delete the item permanently
+func (self trashItem) remove() error {
+	if err := os.RemoveAll(self.filesPath()); err != nil {
+		return err
+	}
+	return os.Remove(self.infoPath())
+}
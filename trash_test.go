@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrashRestore(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, ".data"))
+	writeFiles(t, dir, map[string]string{"a b": "1", "d/a b": "2", "d/x": "X"})
+
+	var items []trashItem
+	for _, name := range []string{"a b", "d/a b"} {
+		item, err := trashPath(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	if items[0].Trash != homeTrash() || items[0].Name != "a b" || items[1].Name != "a b.2" {
+		t.Errorf("trashed as %+v", items)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "a b")); !os.IsNotExist(err) {
+		t.Errorf("a b is still there: %v", err)
+	}
+
+	listed, err := listTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 {
+		t.Fatalf("listed %+v", listed)
+	}
+	for _, item := range listed {
+		want := items[0]
+		if item.Name == items[1].Name {
+			want = items[1]
+		}
+		if item.Original != want.Original || item.Trash != want.Trash || item.Deleted.Unix() != want.Deleted.Unix() {
+			t.Errorf("listed %+v, want %+v", item, want)
+		}
+	}
+
+	// the original path is taken again
+	writeFiles(t, dir, map[string]string{"a b": "new"})
+	if err := items[0].restore(); err == nil {
+		t.Errorf("restored over a file")
+	}
+	os.Remove(filepath.Join(dir, "a b"))
+	for _, item := range items {
+		if err := item.restore(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFiles(t, dir); got["a b"] != "1" || got["d/a b"] != "2" {
+		t.Errorf("got %v", got)
+	}
+	if listed, _ := listTrash(); len(listed) != 0 {
+		t.Errorf("left in trash: %+v", listed)
+	}
+}
+
+// a restored item can be put back where it was
+func TestTrashPutBack(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, ".data"))
+	writeFiles(t, dir, map[string]string{"a": "A"})
+	item, err := trashPath(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := item.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := item.putBack(); err != nil {
+		t.Fatal(err)
+	}
+	listed, _ := listTrash()
+	if len(listed) != 1 || listed[0].Name != item.Name || exists(item.Original) {
+		t.Errorf("put back as %+v", listed)
+	}
+	if err := item.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFiles(t, dir); got["a"] != "A" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestParseTrashInfo(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		trash, info string
+		original    string
+		err         string
+	}{
+		{"Trash", "Path=/home/a%20b/c\nDeletionDate=2024-05-06T07:08:09\n", "/home/a b/c", ""},
+		// relative paths are below the topdir of the trash
+		{"mnt/.Trash/1000", "Path=x/y\n", "mnt/x/y", ""},
+		{"mnt/.Trash-1000", "Path=x/y\n", "mnt/x/y", ""},
+		{"Trash", "[Trash Info]\nDeletionDate=2024-05-06T07:08:09\n", "", "no Path"},
+		{"Trash", "Path=%zz\n", "", "invalid URL escape"},
+	}
+	for _, test := range tests {
+		trash := filepath.Join(dir, test.trash)
+		info := filepath.Join(trash, "info", "f.trashinfo")
+		writeFiles(t, dir, map[string]string{filepath.Join(test.trash, "info", "f.trashinfo"): "[Trash Info]\n" + test.info})
+		item, err := parseTrashInfo(trash, info)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error %v, want %q", test.info, err, test.err)
+			}
+			continue
+		}
+		want := test.original
+		if !filepath.IsAbs(want) {
+			want = filepath.Join(dir, want)
+		}
+		if err != nil || item.Original != want || item.Name != "f" {
+			t.Errorf("%q: %+v, %v, want %v", test.info, item, err, want)
+		}
+	}
+
+	writeFiles(t, dir, map[string]string{"Trash/info/g.trashinfo": "Path=/a\nDeletionDate=2024-05-06T07:08:09\n"})
+	item, err := parseTrashInfo(filepath.Join(dir, "Trash"), filepath.Join(dir, "Trash", "info", "g.trashinfo"))
+	if want := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local); err != nil || !item.Deleted.Equal(want) {
+		t.Errorf("deleted %v, %v, want %v", item.Deleted, err, want)
+	}
+}
@@ -14,37 +14,31 @@ const (
 	ViewFiles ViewType = iota
 	ViewHelp
 	ViewSelections
+	ViewTrash
+	ViewJobs
+	ViewFinder
+	ViewErrors
 )
 
 func (self *model) helpView() string {
 	tbl := table.New().
 		Border(lipgloss.RoundedBorder()).
-		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("#18ff20"))).
+		BorderStyle(self.config.theme.style("border")).
 		Headers("Key", "Action").
 		Width(self.width)
 
-	tbl.Row("q", "Quit application")
-	tbl.Row("?", "Open this help")
-	tbl.Row("j/k/g/G", "Down/Up")
-	tbl.Row("s/t/n", "Sort by size/time/name")
-	tbl.Row("h/l", "Updir/Downdir")
-	tbl.Row("v/V", "Select file")
-	tbl.Row("p", "Copy selections")
-	tbl.Row("P", "Move selections")
-	tbl.Row("D", "Remove selections")
-	tbl.Row("esc", "Clear selections")
-	tbl.Row("o", "Open in app")
-	tbl.Row(".", "Toggle hidden")
-	tbl.Row("f", "Toggle preview")
-	tbl.Row("C-l", "Reload files")
-	tbl.Row("{1..9}", "Bookmark this dir")
-	tbl.Row("f{1..9}", "Go to bookmark")
-
-	return lipgloss.JoinVertical(lipgloss.Left, tbl.Render(), "Press any key to close help")
+	rows := self.config.keys.help()
+	for _, row := range rows[min(self.helpOffset, len(rows)):] {
+		tbl.Row(row[0], row[1])
+	}
+
+	// the table is cut at the bottom; the hint stays visible
+	view := lipgloss.NewStyle().MaxHeight(self.normalHeight() - 1).Render(tbl.Render())
+	return lipgloss.JoinVertical(lipgloss.Left, view, "j/k to scroll, any other key closes help")
 }
 
 func (self *model) toplineView() string {
-	style := lipgloss.NewStyle().Foreground(lipgloss.Color("#006cb6")).Bold(true)
+	style := self.config.theme.style("path").Bold(true)
 	var d string
 	if self.cwd == "/" {
 		d = "/"
@@ -55,22 +49,51 @@ func (self *model) toplineView() string {
 
 	var basename string
 	if !self.empty {
-		style := lipgloss.NewStyle().Foreground(lipgloss.Color("#daf52e"))
+		style := self.config.theme.style("current")
 		f := self.current().Name
 		basename = style.Render(f)
 	}
 
 	view := dirname + basename
+	if f, ok := self.filters[self.cwd]; ok {
+		view += self.config.theme.style("filter").Render(fmt.Sprintf(" [filter: %v]", f.pattern))
+	}
+	if n := self.runningJobs(); n > 0 {
+		view += self.config.theme.style("info").Render(fmt.Sprintf(" [%d jobs]", n))
+	}
 	return view
 }
 
 func (self *model) statusView() (view string) {
+	if self.prompt == nil && len(self.pending) > 0 {
+		return lipgloss.NewStyle().Bold(true).Render(formatKeys(self.pending))
+	}
+	if self.prompt == nil && self.currentView == ViewFinder {
+		style := lipgloss.NewStyle().Bold(true)
+		count := fmt.Sprintf(" %d/%d", len(self.finder.results), len(self.finder.candidates))
+		if self.finder.walking {
+			count += "..."
+		}
+		view = style.Render("find: ") + self.finder.input.View() + self.config.theme.style("info").Render(count)
+		return
+	}
+	if self.prompt != nil {
+		style := lipgloss.NewStyle().Bold(true)
+		if self.prompt.kind == PromptInput {
+			view = style.Render(self.prompt.text) + self.prompt.input.View()
+		} else {
+			view = style.Render(self.prompt.String())
+		}
+		return
+	}
+	// joined errors are separated by newlines
+	text := strings.ReplaceAll(self.status.text, "\n", "; ")
 	if self.status.isErr {
-		style := lipgloss.NewStyle().Foreground(lipgloss.Color("#ff0000"))
-		view = style.Render(fmt.Sprintf("error: %v", self.status.text))
+		style := self.config.theme.style("error")
+		view = style.Render(fmt.Sprintf("error: %v", text))
 	} else {
 		style := lipgloss.NewStyle().Italic(true)
-		view = style.Render(self.status.text)
+		view = style.Render(text)
 	}
 	return
 }
@@ -88,37 +111,56 @@ func (self *model) fileListView() string {
 	for i := begin; i <= end; i++ {
 		file := files[i]
 
+		theme := self.config.theme
 		styleName := lipgloss.NewStyle()
 
-		var fileIcon string
-		if file.IsDir {
-			styleName = styleName.Foreground(lipgloss.Color("#3071ff"))
-			fileIcon = ""
+		if file.Broken {
+			styleName = theme.style("broken").Strikethrough(true)
+		} else if file.IsLink {
+			styleName = theme.style("link")
+		} else if file.IsDir {
+			styleName = theme.style("dir")
 		} else {
-			styleName = styleName.Foreground(lipgloss.Color("#ffffff"))
-			fileIcon = ""
+			styleName = theme.style("file")
+		}
+
+		if self.config.lscolors != nil {
+			if style, ok := self.config.lscolors.style(file); ok {
+				styleName = style.apply(lipgloss.NewStyle())
+			}
 		}
 
 		var selectedIcon string
 		if self.selections.Contains(file.Path) {
 			selectedIcon = "*"
-			styleName = styleName.Bold(true)
+			styleName = theme.apply("selection", styleName.Bold(true))
 		} else {
 			selectedIcon = " "
 		}
 
 		mode := file.Mode.String() // TODO: prettify
-		styleMode := lipgloss.NewStyle().Foreground(lipgloss.Color("#ffd35e"))
+		styleMode := theme.style("mode")
 		viewMode := styleMode.Render(mode)
 
-		styleModified := lipgloss.NewStyle().Foreground(lipgloss.Color("#bbbbbb"))
+		styleModified := theme.style("mtime")
 		viewModified := styleModified.Render(file.Modified.Format("2006-01-02 15:04"))
 
 		if i == self.cursor {
-			styleName = styleName.Background(lipgloss.Color("#616161"))
+			styleName = theme.apply("cursor", styleName)
 		}
 
-		viewFilename := styleName.Render(fmt.Sprintf("%s %s  %s", selectedIcon, fileIcon, file.Name))
+		prefix := selectedIcon + " "
+		if fileIcon, ok := self.config.icon(file); ok {
+			prefix += fileIcon + "  "
+		}
+		viewFilename := styleName.Render(prefix) + self.highlightSearch(file.Name, styleName)
+		if file.IsLink {
+			styleTarget := theme.style("info")
+			if i == self.cursor {
+				styleTarget = theme.apply("cursor", styleTarget)
+			}
+			viewFilename += styleTarget.Render(" -> " + file.LinkTarget)
+		}
 
 		itemView := viewFilename
 		width := 45
@@ -144,7 +186,7 @@ func (self *model) fileListView() string {
 }
 
 func (self *model) previewView() string {
-	style := lipgloss.NewStyle().Foreground(lipgloss.Color("#afafaf")).MaxHeight(self.normalHeight())
+	style := self.config.theme.style("preview").MaxHeight(self.normalHeight())
 	view := style.Render(lipgloss.JoinVertical(lipgloss.Left, self.preview...))
 	return view
 }
@@ -163,6 +205,107 @@ func (self *model) selectionsView() string {
 	return view
 }
 
+func (self *model) errorsView() string {
+	if len(self.configErrors) == 0 {
+		return "no config errors"
+	}
+	style := self.config.theme.style("error")
+	var lines []string
+	for _, err := range self.configErrors {
+		lines = append(lines, style.Render(err.Error()))
+	}
+	view := lipgloss.NewStyle().MaxHeight(self.normalHeight()).Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+	return view
+}
+
+func (self *model) trashView() string {
+	if len(self.trash) == 0 {
+		return "trash is empty"
+	}
+	height := self.normalHeight()
+	begin := max(0, min(self.trashCursor-height/2, len(self.trash)-height))
+	end := min(begin+height, len(self.trash))
+
+	styleDate := self.config.theme.style("info")
+	var lines []string
+	for i := begin; i < end; i++ {
+		item := self.trash[i]
+		styleName := lipgloss.NewStyle()
+		if i == self.trashCursor {
+			styleName = self.config.theme.style("cursor")
+		}
+		line := styleDate.Render(item.Deleted.Format("2006-01-02 15:04")) + " " +
+			styleName.Render(withTilde(item.Original))
+		lines = append(lines, line)
+	}
+	style := lipgloss.NewStyle().MaxHeight(height)
+	return style.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (self *model) jobsView() string {
+	if len(self.jobs) == 0 {
+		return "no jobs"
+	}
+	height := self.normalHeight()
+	begin := max(0, min(self.jobsCursor-height/2, len(self.jobs)-height))
+	end := min(begin+height, len(self.jobs))
+
+	var lines []string
+	for i := begin; i < end; i++ {
+		job := self.jobs[i]
+		styleState := self.config.theme.style("info")
+		if job.state == JobFailed {
+			styleState = self.config.theme.style("error")
+		}
+		styleLine := lipgloss.NewStyle()
+		if i == self.jobsCursor {
+			styleLine = self.config.theme.style("cursor")
+		}
+		text := job.progress.String()
+		if job.err != nil {
+			text = strings.ReplaceAll(job.err.Error(), "\n", "; ")
+		}
+		line := fmt.Sprintf("%3d %s %s ", job.id, job.started.Format("15:04:05"), styleState.Render(fmt.Sprintf("%-9s", job.state))) +
+			styleLine.Render(text)
+		lines = append(lines, line)
+	}
+	style := lipgloss.NewStyle().MaxHeight(height)
+	return style.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (self *model) finderView() string {
+	finder := self.finder
+	if len(finder.results) == 0 {
+		return "no matches"
+	}
+	height := self.normalHeight()
+	begin := max(0, min(finder.cursor-height/2, len(finder.results)-height))
+	end := min(begin+height, len(finder.results))
+
+	styleMatch := self.config.theme.style("match").Bold(true)
+	var lines []string
+	for i := begin; i < end; i++ {
+		result := finder.results[i]
+		style := lipgloss.NewStyle()
+		if i == finder.cursor {
+			style = self.config.theme.style("cursor")
+		}
+		var line strings.Builder
+		next := 0
+		for j, r := range []rune(result.path) {
+			if next < len(result.positions) && result.positions[next] == j {
+				line.WriteString(styleMatch.Inherit(style).Render(string(r)))
+				next++
+			} else {
+				line.WriteString(style.Render(string(r)))
+			}
+		}
+		lines = append(lines, line.String())
+	}
+	style := lipgloss.NewStyle().MaxHeight(height)
+	return style.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
 func (self model) View() string {
 	if self.height < 3 || self.width < 10 {
 		return "..."
@@ -174,6 +317,14 @@ func (self model) View() string {
 		mainView = self.helpView()
 	} else if self.currentView == ViewSelections {
 		mainView = self.selectionsView()
+	} else if self.currentView == ViewErrors {
+		mainView = self.errorsView()
+	} else if self.currentView == ViewTrash {
+		mainView = self.trashView()
+	} else if self.currentView == ViewJobs {
+		mainView = self.jobsView()
+	} else if self.currentView == ViewFinder {
+		mainView = self.finderView()
 	} else if self.empty {
 		mainView = "very empty here, innit?"
 	} else if self.config.preview {